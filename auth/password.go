@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// PASSWORD_COST is the bcrypt cost used for new password hashes.
+	PASSWORD_COST = 12
+
+	// MIN_PASSWORD_LENGTH is the minimum number of characters of a password.
+	MIN_PASSWORD_LENGTH = 5
+)
+
+// HashPassword returns the bcrypt hash of the given password.
+func HashPassword(password string) (string, error) {
+	if len(password) < MIN_PASSWORD_LENGTH {
+		return "", fmt.Errorf("password length must be at least %d characters", MIN_PASSWORD_LENGTH)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), PASSWORD_COST)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password : %s", err)
+	}
+
+	return string(hash), nil
+}
+
+// VerifyPassword reports whether the given password matches the stored one.
+// Stored values which are not bcrypt hashes are legacy plaintext passwords
+// and are compared in constant time.
+func VerifyPassword(stored, password string) bool {
+	if !isHashed(stored) {
+		return subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) == nil
+}
+
+// NeedsRehash reports whether the stored password is plaintext or hashed
+// with a lower cost than PASSWORD_COST, so it should be hashed again.
+func NeedsRehash(stored string) bool {
+	cost, err := bcrypt.Cost([]byte(stored))
+	if err != nil {
+		return true
+	}
+
+	return cost < PASSWORD_COST
+}
+
+func isHashed(stored string) bool {
+	_, err := bcrypt.Cost([]byte(stored))
+	return err == nil
+}
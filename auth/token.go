@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// tokenHeader is the encoded JWT header of all tokens, which are signed with HMAC-SHA256.
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Claims are the contents of an access token.
+type Claims struct {
+	// ID uniquely identifies the token so that it can be revoked.
+	ID        string `json:"jti"`
+	UserID    int    `json:"uid"`
+	Email     string `json:"email"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+
+	// Scope restricts the token to a single resource, like the stream of a signal.
+	// The tokens without a scope give access to the whole API.
+	Scope string `json:"scope,omitempty"`
+}
+
+// NewToken issues a token for the given user which expires after ttl.
+func NewToken(secret []byte, userID int, email string, ttl time.Duration) (string, *Claims, error) {
+	return NewScopedToken(secret, userID, email, "", ttl)
+}
+
+// NewScopedToken issues a token for the given user restricted to the given scope, which expires after ttl.
+func NewScopedToken(secret []byte, userID int, email, scope string, ttl time.Duration) (string, *Claims, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, fmt.Errorf("failed to generate token id : %s", err)
+	}
+
+	now := time.Now()
+	claims := &Claims{
+		ID:        hex.EncodeToString(id),
+		UserID:    userID,
+		Email:     email,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+		Scope:     scope,
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to encode token claims : %s", err)
+	}
+
+	unsigned := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + sign(secret, unsigned), claims, nil
+}
+
+// ParseToken verifies the signature and expiry of the given token and returns its claims.
+func ParseToken(secret []byte, token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != tokenHeader {
+		return nil, fmt.Errorf("malformed token")
+	}
+
+	expected := sign(secret, parts[0]+"."+parts[1])
+	if !hmac.Equal([]byte(expected), []byte(parts[2])) {
+		return nil, fmt.Errorf("invalid token signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token payload : %s", err)
+	}
+
+	var claims Claims
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims : %s", err)
+	}
+
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, fmt.Errorf("token is expired")
+	}
+
+	return &claims, nil
+}
+
+func sign(secret []byte, data string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(data))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,108 @@
+package billing
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/heroku/stocksignals/model"
+	"github.com/heroku/stocksignals/store"
+)
+
+// PeriodOf returns the start and the end of the billing period containing
+// the given time. Billing periods are calendar months in UTC.
+func PeriodOf(t time.Time) (time.Time, time.Time) {
+	t = t.UTC()
+	start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 1, 0)
+}
+
+// Prorate returns the part of the price of a full period [periodStart,
+// periodEnd) for a subscription active in [from, to). A zero to means the
+// subscription is still active. The result is rounded to cents.
+func Prorate(price float64, periodStart, periodEnd, from, to int64) float64 {
+	if from < periodStart {
+		from = periodStart
+	}
+
+	if to == 0 || to > periodEnd {
+		to = periodEnd
+	}
+
+	if to <= from || periodEnd <= periodStart {
+		return 0
+	}
+
+	amount := price * float64(to-from) / float64(periodEnd-periodStart)
+	return math.Floor(amount*100+0.5) / 100
+}
+
+// GenerateInvoices saves the invoices of the previous and the current billing
+// periods of all subscriptions, prorated to the time they were active, and
+// marks the unpaid invoices past their due time as overdue. Invoices are due
+// the given duration after they are generated.
+func GenerateInvoices(now time.Time, due time.Duration) error {
+	currentStart, _ := PeriodOf(now)
+	previousStart, _ := PeriodOf(currentStart.Add(-time.Second))
+
+	subscriptions, err := store.GetBillableSubscriptions(previousStart.Unix())
+	if err != nil {
+		return err
+	}
+
+	for _, subscription := range subscriptions {
+		var end int64
+		if subscription.EndTime != nil {
+			end = *subscription.EndTime
+		}
+
+		for periodStart := previousStart; !periodStart.After(currentStart); periodStart = periodStart.AddDate(0, 1, 0) {
+			periodEnd := periodStart.AddDate(0, 1, 0)
+			amount := Prorate(subscription.Price, periodStart.Unix(), periodEnd.Unix(), subscription.StartTime, end)
+			if amount <= 0 {
+				continue
+			}
+
+			invoice := model.Invoice{
+				SubscriptionID: subscription.ID,
+				UserID:         subscription.UserID,
+				SignalID:       subscription.SignalID,
+				PeriodStart:    periodStart.Unix(),
+				PeriodEnd:      periodEnd.Unix(),
+				Amount:         amount,
+				DueTime:        now.Add(due).Unix(),
+			}
+			if err = store.SaveInvoice(invoice); err != nil {
+				return err
+			}
+		}
+	}
+
+	return store.MarkOverdueInvoices(now.Unix())
+}
+
+// PayInvoice charges the invoice with the given id of the given user through the gateway. The invoice
+// is claimed as pending before it is charged, so that concurrent payments cannot charge it twice, and
+// released if the charge fails. An invoice whose charge succeeds but cannot be marked as paid stays
+// pending, to be reconciled with the gateway.
+func PayInvoice(gateway Gateway, invoiceID, userID int) (*model.Invoice, error) {
+	invoice, err := store.ClaimInvoice(invoiceID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	reference, err := gateway.Charge(*invoice)
+	if err != nil {
+		if errRelease := store.ReleaseInvoice(invoiceID, time.Now().Unix()); errRelease != nil {
+			log.Printf("failed to release invoice %d after a failed charge : %s", invoiceID, errRelease)
+		}
+		return nil, fmt.Errorf("failed to charge invoice %d : %s", invoiceID, err)
+	}
+
+	if err = store.MarkInvoicePaid(invoiceID, reference); err != nil {
+		return nil, err
+	}
+
+	return store.GetInvoiceByID(invoiceID)
+}
@@ -0,0 +1,36 @@
+package billing
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/heroku/stocksignals/model"
+)
+
+// FAKE_GATEWAY is the name of the local gateway which accepts every charge without collecting money.
+const FAKE_GATEWAY = "fake"
+
+func init() {
+	RegisterGateway(FAKE_GATEWAY, func() Gateway { return &FakeGateway{} })
+}
+
+// FakeGateway is a local gateway for development and testing. It records the
+// charged invoices and fails the charges of the invoices in Declined.
+type FakeGateway struct {
+	mutex    sync.Mutex
+	Declined map[int]bool
+	Charges  []model.Invoice
+}
+
+// Charge records the given invoice, or declines it if its id is in Declined.
+func (g *FakeGateway) Charge(invoice model.Invoice) (string, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.Declined[invoice.ID] {
+		return "", fmt.Errorf("payment of invoice %d is declined", invoice.ID)
+	}
+
+	g.Charges = append(g.Charges, invoice)
+	return fmt.Sprintf("fake-%d-%d", invoice.ID, len(g.Charges)), nil
+}
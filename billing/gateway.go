@@ -0,0 +1,48 @@
+package billing
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/heroku/stocksignals/model"
+)
+
+// Gateway charges the invoices of the subscribers.
+type Gateway interface {
+	// Charge collects the amount of the given invoice and returns the
+	// reference of the payment in the gateway.
+	Charge(invoice model.Invoice) (string, error)
+}
+
+var (
+	gatewaysMutex sync.Mutex
+	gateways      = make(map[string]func() Gateway)
+)
+
+// RegisterGateway makes a gateway available by the given name.
+func RegisterGateway(name string, factory func() Gateway) {
+	gatewaysMutex.Lock()
+	defer gatewaysMutex.Unlock()
+
+	gateways[name] = factory
+}
+
+// NewGateway creates the gateway registered with the given name.
+func NewGateway(name string) (Gateway, error) {
+	gatewaysMutex.Lock()
+	defer gatewaysMutex.Unlock()
+
+	factory, ok := gateways[name]
+	if !ok {
+		var names []string
+		for name := range gateways {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown payment gateway %s, available gateways are %s", name, strings.Join(names, ", "))
+	}
+
+	return factory(), nil
+}
@@ -0,0 +1,167 @@
+// Package cli implements the stocksignals command line tool, which runs the
+// web server and lets the operators manage the signals, orders, stats and
+// users directly through the store, without going through the API.
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/heroku/stocksignals/config"
+	"github.com/heroku/stocksignals/server"
+	"github.com/heroku/stocksignals/stockapi"
+	"github.com/heroku/stocksignals/store"
+)
+
+// command is a subcommand of the tool. Its run function receives the arguments following its name.
+type command struct {
+	usage string
+	run   func(cfg *config.Config, args []string) error
+}
+
+var (
+	// Schema is the script run by the migrate command.
+	Schema string
+
+	// stdout is where the commands write their results.
+	stdout io.Writer = os.Stdout
+
+	// commands are the subcommands by name, set on init since their flags refer to their usage.
+	commands map[string]command
+)
+
+func init() {
+	commands = map[string]command{
+		"serve":                {"serve", serve},
+		"migrate":              {"migrate", migrate},
+		"signals list":         {"signals list [-archived] [-limit n]", listSignals},
+		"signals create":       {"signals create -name name -price price -owner email [-description text] [-tags a,b]", createSignal},
+		"signals archive":      {"signals archive -id id[,id...] [-user email]", archiveSignals},
+		"orders import":        {"orders import -signal id -file statement.csv [-mapping name] [-user email] [-dry-run]", importOrders},
+		"orders replay":        {"orders replay -signal id -file orders.csv|orders.jsonl [-user email] [-dry-run]", replayOrders},
+		"stats snapshot":       {"stats snapshot [-concurrency n]", snapshotStats},
+		"users create":         {"users create -email email -password password [-role admin|provider|subscriber]", createUser},
+		"users reset-password": {"users reset-password -email email [-password password]", resetPassword},
+		"export":               {"export -signal id [-dataset orders|holdings|stats] [-format csv|jsonl] [-o file]", runExport},
+	}
+}
+
+// Run runs the subcommand named by the given arguments, without the program name.
+// The web server is run when no subcommand is given.
+func Run(args []string) error {
+	name, rest := "serve", args
+	if len(args) > 0 {
+		name, rest = args[0], args[1:]
+		if _, ok := commands[name]; !ok && len(args) > 1 {
+			name, rest = args[0]+" "+args[1], args[2:]
+		}
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		return fmt.Errorf("unknown command %q\n\n%s", strings.Join(args, " "), usage())
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	if err = cmd.run(cfg, rest); err == flag.ErrHelp {
+		return nil
+	}
+	return err
+}
+
+// usage lists the usage of all the commands
+func usage() string {
+	var lines []string
+	for _, cmd := range commands {
+		lines = append(lines, "  stocksignals "+cmd.usage)
+	}
+	sort.Strings(lines)
+	return "Usage:\n" + strings.Join(lines, "\n")
+}
+
+// newFlags returns the flag set of the given command, which reports its errors instead of exiting
+func newFlags(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: stocksignals %s\n", commands[name].usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// connect opens the database connection of the commands working on the store, and configures
+// the quotes of the orders and stats
+func connect(cfg *config.Config) error {
+	stockapi.Configure(cfg.Quotes)
+	return store.Connect(cfg.Database)
+}
+
+// userID returns the id of the user with the given email, or 0 for the system when it is empty
+func userID(email string) (int, error) {
+	if email == "" {
+		return 0, nil
+	}
+
+	user, err := store.GetUser(email)
+	if err != nil {
+		return 0, err
+	}
+	return user.ID, nil
+}
+
+// printJSON writes the given result as indented JSON
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// printTable writes the given rows as aligned columns under the given header
+func printTable(header []string, rows [][]interface{}) error {
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = fmt.Sprint(cell)
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+	return w.Flush()
+}
+
+func serve(cfg *config.Config, args []string) error {
+	if err := newFlags("serve").Parse(args); err != nil {
+		return err
+	}
+
+	return server.Run(cfg)
+}
+
+func migrate(cfg *config.Config, args []string) error {
+	if err := newFlags("migrate").Parse(args); err != nil {
+		return err
+	}
+
+	if err := connect(cfg); err != nil {
+		return err
+	}
+	defer store.Disconnect()
+
+	if err := store.Migrate(Schema); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(stdout, "database is migrated")
+	return nil
+}
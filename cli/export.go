@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/heroku/stocksignals/config"
+	"github.com/heroku/stocksignals/export"
+	"github.com/heroku/stocksignals/store"
+)
+
+// runExport writes the zip bundle of a signal, or one of its datasets, to a file or the standard output:
+//
+//	stocksignals export -signal 42 [-dataset orders] [-format csv|jsonl] [-o file]
+func runExport(cfg *config.Config, args []string) error {
+	flags := newFlags("export")
+	signalID := flags.Int("signal", 0, "id of the signal to export")
+	dataset := flags.String("dataset", "", "dataset to export, one of orders, holdings or stats; all of them in a zip bundle when empty")
+	format := flags.String("format", export.CSV, "format of the datasets, csv or jsonl")
+	output := flags.String("o", "", "file to write the export to; the standard output when empty")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *signalID <= 0 {
+		return fmt.Errorf("a signal id must be given with -signal")
+	}
+
+	if err := export.Check(*dataset, *format); err != nil {
+		return err
+	}
+
+	if err := connect(cfg); err != nil {
+		return err
+	}
+	defer store.Disconnect()
+
+	signal, err := store.GetSignalByID(*signalID)
+	if err != nil {
+		return err
+	}
+
+	w := stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create %s : %s", *output, err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if *dataset == "" {
+		return export.WriteBundle(w, *signal, *format, time.Now())
+	}
+
+	_, err = export.WriteDataset(w, signal.ID, *dataset, *format)
+	return err
+}
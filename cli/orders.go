@@ -0,0 +1,158 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/heroku/stocksignals/config"
+	"github.com/heroku/stocksignals/engine"
+	"github.com/heroku/stocksignals/export"
+	"github.com/heroku/stocksignals/importer"
+	"github.com/heroku/stocksignals/model"
+	"github.com/heroku/stocksignals/stockapi"
+	"github.com/heroku/stocksignals/store"
+	"github.com/heroku/stocksignals/validation"
+)
+
+// orderFlags are the flags shared by the commands registering orders to a signal
+type orderFlags struct {
+	signalID *int
+	file     *string
+	user     *string
+	dryRun   *bool
+}
+
+func newOrderFlags(flags *flag.FlagSet) orderFlags {
+	return orderFlags{
+		signalID: flags.Int("signal", 0, "id of the signal receiving the orders"),
+		file:     flags.String("file", "", "file to read the orders from"),
+		user:     flags.String("user", "", "email of the user recorded in the audit log; the system when empty"),
+		dryRun:   flags.Bool("dry-run", false, "preview the resulting orders and portfolio without saving them"),
+	}
+}
+
+func (f orderFlags) check() error {
+	if *f.signalID <= 0 {
+		return fmt.Errorf("a signal id must be given with -signal")
+	}
+
+	if *f.file == "" {
+		return fmt.Errorf("a file must be given with -file")
+	}
+	return nil
+}
+
+func importOrders(cfg *config.Config, args []string) error {
+	flags := newFlags("orders import")
+	f := newOrderFlags(flags)
+	name := flags.String("mapping", config.DEFAULT_IMPORT_MAPPING, "configured import mapping of the statement columns")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if err := f.check(); err != nil {
+		return err
+	}
+
+	mapping, ok := cfg.Import.Mappings[*name]
+	if !ok {
+		return fmt.Errorf("unknown import mapping %s", *name)
+	}
+
+	file, err := os.Open(*f.file)
+	if err != nil {
+		return fmt.Errorf("failed to open %s : %s", *f.file, err)
+	}
+	defer file.Close()
+
+	orders, err := importer.Parse(file, mapping, *f.signalID, cfg.Import.MaxRows, time.Now())
+	if err != nil {
+		return describe(err)
+	}
+
+	return executeOrders(cfg, f, orders)
+}
+
+func replayOrders(cfg *config.Config, args []string) error {
+	flags := newFlags("orders replay")
+	f := newOrderFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if err := f.check(); err != nil {
+		return err
+	}
+
+	file, err := os.Open(*f.file)
+	if err != nil {
+		return fmt.Errorf("failed to open %s : %s", *f.file, err)
+	}
+	defer file.Close()
+
+	format := strings.TrimPrefix(filepath.Ext(*f.file), ".")
+	orders, err := export.ReadOrders(file, format)
+	if err != nil {
+		return describe(err)
+	}
+
+	for i := range orders {
+		orders[i].SignalID = *f.signalID
+	}
+
+	return executeOrders(cfg, f, orders)
+}
+
+// executeOrders validates and registers the given orders, or only previews them on a dry run.
+// The registered orders are published like the orders registered through the API, but they are
+// not copied to the followers since they are past orders.
+func executeOrders(cfg *config.Config, f orderFlags, orders []model.Order) error {
+	now := time.Now()
+	if err := validation.Orders(orders, now); err != nil {
+		return describe(err)
+	}
+
+	if err := connect(cfg); err != nil {
+		return err
+	}
+	defer store.Disconnect()
+
+	id, err := userID(*f.user)
+	if err != nil {
+		return err
+	}
+
+	if _, err = store.GetSignalByID(*f.signalID); err != nil {
+		return err
+	}
+
+	prepared, err := stockapi.PrepareOrders(orders, now)
+	if err != nil {
+		return err
+	}
+
+	if *f.dryRun {
+		simulated, portfolios, err := store.SimulateOrders(prepared, id)
+		if err != nil {
+			return describe(err)
+		}
+		return printJSON(map[string]interface{}{"dry_run": true, "orders": simulated, "portfolios": portfolios})
+	}
+
+	// Deliver the notifications and webhooks of the orders before exiting
+	delivery := engine.StartDelivery(context.Background(), cfg)
+	defer delivery.Close()
+
+	registered, err := engine.RegisterOrders(prepared, id)
+	if err != nil {
+		return describe(err)
+	}
+
+	fmt.Fprintf(stdout, "%d orders are registered to signal %d\n", len(registered), *f.signalID)
+	return nil
+}
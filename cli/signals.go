@@ -0,0 +1,159 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/heroku/stocksignals/config"
+	"github.com/heroku/stocksignals/model"
+	"github.com/heroku/stocksignals/store"
+	"github.com/heroku/stocksignals/validation"
+)
+
+func listSignals(cfg *config.Config, args []string) error {
+	flags := newFlags("signals list")
+	archived := flags.Bool("archived", false, "list the archived signals instead of the listed ones")
+	limit := flags.Int("limit", 0, "greatest number of signals to list; all of them when 0")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if err := connect(cfg); err != nil {
+		return err
+	}
+	defer store.Disconnect()
+
+	var signals []model.Signal
+	var err error
+	if *archived {
+		signals, _, err = store.ListArchivedSignals(store.Page{Limit: *limit})
+	} else {
+		signals, _, err = store.ListSignals("id", false, store.Page{Limit: *limit})
+	}
+
+	if err != nil {
+		return err
+	}
+
+	var rows [][]interface{}
+	for _, s := range signals {
+		owner := "-"
+		if s.OwnerID != nil {
+			owner = strconv.Itoa(*s.OwnerID)
+		}
+		rows = append(rows, []interface{}{s.ID, s.Name, owner, s.Price, s.NumSubscribers, s.NumTrades, strings.Join(s.Tags, ",")})
+	}
+
+	return printTable([]string{"ID", "NAME", "OWNER", "PRICE", "SUBSCRIBERS", "TRADES", "TAGS"}, rows)
+}
+
+func createSignal(cfg *config.Config, args []string) error {
+	flags := newFlags("signals create")
+	name := flags.String("name", "", "name of the signal")
+	description := flags.String("description", "", "description of the signal")
+	price := flags.Float64("price", 0, "subscription price of the signal")
+	owner := flags.String("owner", "", "email of the user owning the signal")
+	tags := flags.String("tags", "", "comma separated tags of the signal, such as sector:technology,risk:low")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	signal := model.Signal{Name: *name, Description: *description, Price: *price}
+	if *tags != "" {
+		signal.Tags = model.Tags(strings.Split(*tags, ","))
+	}
+
+	if err := validation.Signals([]model.Signal{signal}); err != nil {
+		return describe(err)
+	}
+
+	if *owner == "" {
+		return fmt.Errorf("the owner of the signal must be given with -owner")
+	}
+
+	if err := connect(cfg); err != nil {
+		return err
+	}
+	defer store.Disconnect()
+
+	ownerID, err := userID(*owner)
+	if err != nil {
+		return err
+	}
+
+	if err = store.RegisterSignals([]model.Signal{signal}, ownerID); err != nil {
+		return describe(err)
+	}
+
+	fmt.Fprintln(stdout, "signal is created")
+	return nil
+}
+
+func archiveSignals(cfg *config.Config, args []string) error {
+	flags := newFlags("signals archive")
+	idList := flags.String("id", "", "comma separated ids of the signals to archive")
+	user := flags.String("user", "", "email of the user recorded in the audit log; the system when empty")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	ids, err := parseIDs(*idList)
+	if err != nil {
+		return err
+	}
+
+	if err = connect(cfg); err != nil {
+		return err
+	}
+	defer store.Disconnect()
+
+	id, err := userID(*user)
+	if err != nil {
+		return err
+	}
+
+	if err = store.ArchiveSignals(ids, id); err != nil {
+		return err
+	}
+
+	if len(ids) == 1 {
+		fmt.Fprintln(stdout, "signal is archived")
+	} else {
+		fmt.Fprintln(stdout, "signals are archived")
+	}
+	return nil
+}
+
+// parseIDs parses the given comma separated ids
+func parseIDs(list string) ([]int, error) {
+	if list == "" {
+		return nil, fmt.Errorf("no id is given")
+	}
+
+	var ids []int
+	for _, str := range strings.Split(list, ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(str))
+		if err != nil {
+			return nil, fmt.Errorf("invalid id %q", str)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// describe adds the invalid fields of a validation error to its message
+func describe(err error) error {
+	e, ok := err.(*store.Error)
+	if !ok || len(e.Fields) == 0 {
+		return err
+	}
+
+	var fields []string
+	for field, message := range e.Fields {
+		fields = append(fields, fmt.Sprintf("  %s: %s", field, message))
+	}
+	sort.Strings(fields)
+	return fmt.Errorf("%s\n%s", e.Message, strings.Join(fields, "\n"))
+}
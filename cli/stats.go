@@ -0,0 +1,40 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/heroku/stocksignals/config"
+	"github.com/heroku/stocksignals/engine"
+	"github.com/heroku/stocksignals/store"
+)
+
+func snapshotStats(cfg *config.Config, args []string) error {
+	flags := newFlags("stats snapshot")
+	concurrency := flags.Int("concurrency", cfg.Scheduler.StatsConcurrency, "greatest number of signals processed at once")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if err := connect(cfg); err != nil {
+		return err
+	}
+	defer store.Disconnect()
+
+	delivery := engine.StartDelivery(context.Background(), cfg)
+	defer delivery.Close()
+
+	snapshot, err := engine.SaveAllStats(*concurrency)
+	if err != nil {
+		return err
+	}
+
+	if err = printJSON(snapshot); err != nil {
+		return err
+	}
+
+	if len(snapshot.Failed) > 0 {
+		return fmt.Errorf("failed to save the stats of %d signals", len(snapshot.Failed))
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/heroku/stocksignals/config"
+	"github.com/heroku/stocksignals/model"
+	"github.com/heroku/stocksignals/store"
+)
+
+// GENERATED_PASSWORD_BYTES is the number of random bytes of the generated passwords.
+const GENERATED_PASSWORD_BYTES = 12
+
+func createUser(cfg *config.Config, args []string) error {
+	flags := newFlags("users create")
+	email := flags.String("email", "", "email of the user")
+	password := flags.String("password", "", "password of the user")
+	role := flags.String("role", model.SUBSCRIBER, "role of the user, admin, provider or subscriber")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if err := connect(cfg); err != nil {
+		return err
+	}
+	defer store.Disconnect()
+
+	if err := store.CreateUser(model.User{Email: *email, Password: *password, Role: *role}); err != nil {
+		return describe(err)
+	}
+
+	fmt.Fprintln(stdout, "user is created")
+	return nil
+}
+
+func resetPassword(cfg *config.Config, args []string) error {
+	flags := newFlags("users reset-password")
+	email := flags.String("email", "", "email of the user")
+	password := flags.String("password", "", "new password of the user; a random one is generated and printed when empty")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	generated := *password == ""
+	if generated {
+		b := make([]byte, GENERATED_PASSWORD_BYTES)
+		if _, err := rand.Read(b); err != nil {
+			return fmt.Errorf("failed to generate password : %s", err)
+		}
+		*password = base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	if err := connect(cfg); err != nil {
+		return err
+	}
+	defer store.Disconnect()
+
+	if err := store.ResetPassword(*email, *password); err != nil {
+		return describe(err)
+	}
+
+	if generated {
+		fmt.Fprintf(stdout, "password is reset to %s\n", *password)
+	} else {
+		fmt.Fprintln(stdout, "password is reset")
+	}
+	return nil
+}
@@ -0,0 +1,529 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// CONFIG_FILE_ENV is the environment variable holding the path of the optional YAML configuration file.
+	CONFIG_FILE_ENV = "STOCKSIGNALS_CONFIG"
+
+	DEFAULT_READ_TIMEOUT     = 15 * time.Second
+	DEFAULT_WRITE_TIMEOUT    = 30 * time.Second
+	DEFAULT_IDLE_TIMEOUT     = 2 * time.Minute
+	DEFAULT_SHUTDOWN_TIMEOUT = 25 * time.Second
+
+	DEFAULT_MAX_OPEN_CONNS     = 10
+	DEFAULT_MAX_IDLE_CONNS     = 5
+	DEFAULT_CONN_MAX_LIFETIME  = 30 * time.Minute
+	DEFAULT_QUOTES_BASE_URI    = "https://api.iextrading.com/1.0/tops/last?symbols=%s"
+	DEFAULT_QUOTES_TIMEOUT     = 10 * time.Second
+	DEFAULT_STATS_INTERVAL     = 6 * time.Hour
+	DEFAULT_STATS_CONCURRENCY  = 4
+	DEFAULT_AUTH_TOKEN_TTL     = 24 * time.Hour
+	DEFAULT_BILLING_GATEWAY    = "fake"
+	DEFAULT_BILLING_INTERVAL   = time.Hour
+	DEFAULT_INVOICE_DUE        = 7 * 24 * time.Hour
+	DEFAULT_SMTP_PORT          = 587
+	DEFAULT_WEBHOOK_TIMEOUT    = 10 * time.Second
+	DEFAULT_NOTIFY_ATTEMPTS    = 5
+	DEFAULT_NOTIFY_BACKOFF     = time.Second
+	DEFAULT_NOTIFY_WORKERS     = 4
+	DEFAULT_WEBHOOK_ATTEMPTS   = 8
+	DEFAULT_WEBHOOK_BACKOFF    = 2 * time.Second
+	DEFAULT_WEBHOOK_WORKERS    = 4
+	DEFAULT_RANKING_INTERVAL   = time.Hour
+	DEFAULT_RANKING_HISTORY    = 30 * 24 * time.Hour
+	DEFAULT_RANKING_TRADES     = 5
+	DEFAULT_IMPORT_MAPPING     = "generic"
+	DEFAULT_IMPORT_MAX_ROWS    = 5000
+	DEFAULT_IMPORT_DATE_FORMAT = "2006-01-02"
+	DEFAULT_IDEMPOTENCY_TTL    = 24 * time.Hour
+	DEFAULT_IDEMPOTENCY_LOCK   = time.Minute
+	MIN_AUTH_TOKEN_SECRET_SIZE = 32
+)
+
+// Config holds the settings of the whole service.
+type Config struct {
+	Port        string            `yaml:"port"`
+	Server      ServerConfig      `yaml:"server"`
+	Database    DatabaseConfig    `yaml:"database"`
+	Quotes      QuotesConfig      `yaml:"quotes"`
+	Scheduler   SchedulerConfig   `yaml:"scheduler"`
+	Auth        AuthConfig        `yaml:"auth"`
+	Billing     BillingConfig     `yaml:"billing"`
+	Notify      NotifyConfig      `yaml:"notify"`
+	Webhooks    WebhooksConfig    `yaml:"webhooks"`
+	Ranking     RankingConfig     `yaml:"ranking"`
+	Import      ImportConfig      `yaml:"import"`
+	Idempotency IdempotencyConfig `yaml:"idempotency"`
+}
+
+// ServerConfig holds the timeouts of the HTTP server.
+type ServerConfig struct {
+	ReadTimeout  time.Duration `yaml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout"`
+
+	// ShutdownTimeout is the time given to in-flight requests to complete on
+	// shutdown. Heroku kills a dyno 30 seconds after sending SIGTERM.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+// DatabaseConfig holds the database connection pool settings.
+type DatabaseConfig struct {
+	URL             string        `yaml:"url"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+}
+
+// QuotesConfig holds the settings of the stock quote provider.
+type QuotesConfig struct {
+	// BaseURI is the quote URI with a %s verb for the comma separated symbols.
+	BaseURI string        `yaml:"base_uri"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// SchedulerConfig holds the settings of the background jobs.
+type SchedulerConfig struct {
+	StatsInterval    time.Duration `yaml:"stats_interval"`
+	StatsConcurrency int           `yaml:"stats_concurrency"`
+}
+
+// AuthConfig holds the settings of the API authentication.
+type AuthConfig struct {
+	// TokenSecret is the key signing the access tokens.
+	TokenSecret string        `yaml:"token_secret"`
+	TokenTTL    time.Duration `yaml:"token_ttl"`
+}
+
+// BillingConfig holds the settings of the subscription billing.
+type BillingConfig struct {
+	// Gateway is the name of the payment gateway charging the invoices.
+	Gateway string `yaml:"gateway"`
+
+	// Interval is the interval between two invoice generations.
+	Interval time.Duration `yaml:"interval"`
+
+	// InvoiceDue is the time given to pay an invoice before it is overdue.
+	InvoiceDue time.Duration `yaml:"invoice_due"`
+}
+
+// NotifyConfig holds the settings of the subscriber notifications.
+type NotifyConfig struct {
+	// SMTPHost is the mail server sending the email notifications. Email
+	// notifications are disabled if it is not set.
+	SMTPHost     string `yaml:"smtp_host"`
+	SMTPPort     int    `yaml:"smtp_port"`
+	SMTPUsername string `yaml:"smtp_username"`
+	SMTPPassword string `yaml:"smtp_password"`
+	EmailFrom    string `yaml:"email_from"`
+
+	WebhookTimeout time.Duration `yaml:"webhook_timeout"`
+
+	// MaxAttempts is the number of times a notification is sent before it is logged as failed.
+	MaxAttempts int `yaml:"max_attempts"`
+
+	// RetryBackoff is the wait before the first retry, doubled on each retry.
+	RetryBackoff time.Duration `yaml:"retry_backoff"`
+
+	// Workers is the number of notifications sent at the same time.
+	Workers int `yaml:"workers"`
+}
+
+// WebhooksConfig holds the settings of the signed signal webhooks.
+type WebhooksConfig struct {
+	Timeout time.Duration `yaml:"timeout"`
+
+	// MaxAttempts is the number of times a payload is sent before it becomes a dead letter.
+	MaxAttempts int `yaml:"max_attempts"`
+
+	// RetryBackoff is the wait before the first retry, doubled on each retry.
+	RetryBackoff time.Duration `yaml:"retry_backoff"`
+
+	// Workers is the number of payloads sent at the same time.
+	Workers int `yaml:"workers"`
+}
+
+// RankingConfig holds the settings of the signal leaderboard.
+type RankingConfig struct {
+	// Interval is the interval between two refreshes of the cached rankings.
+	Interval time.Duration `yaml:"interval"`
+
+	// MinHistory is the track record length, from the first trade, a signal needs to be ranked.
+	MinHistory time.Duration `yaml:"min_history"`
+
+	// MinTrades is the number of trades a signal needs to be ranked.
+	MinTrades int `yaml:"min_trades"`
+
+	// Weights are the weights of the metrics in the composite score.
+	Weights RankingWeights `yaml:"weights"`
+}
+
+// RankingWeights are the relative weights of the ranking metrics.
+type RankingWeights struct {
+	RiskAdjustedReturn float64 `yaml:"risk_adjusted_return"`
+	Drawdown           float64 `yaml:"drawdown"`
+	TrackRecord        float64 `yaml:"track_record"`
+	Trades             float64 `yaml:"trades"`
+	Subscribers        float64 `yaml:"subscribers"`
+}
+
+// ImportConfig holds the settings of the order imports from broker CSV statements.
+type ImportConfig struct {
+	// Mappings are the column mappings of the broker statements, by name.
+	// The generic mapping is always available unless it is overridden.
+	Mappings map[string]ImportMapping `yaml:"mappings"`
+
+	// MaxRows is the greatest number of orders of an import.
+	MaxRows int `yaml:"max_rows"`
+}
+
+// ImportMapping maps the columns of a broker CSV statement, by header name, to the order fields.
+// The side and fees columns are optional: without a side column, negative quantities are sells,
+// and the fees column is ignored when the statement does not have it.
+type ImportMapping struct {
+	Date     string `yaml:"date"`
+	Side     string `yaml:"side"`
+	Symbol   string `yaml:"symbol"`
+	Quantity string `yaml:"quantity"`
+	Price    string `yaml:"price"`
+	Fees     string `yaml:"fees"`
+
+	// DateFormat is the Go time layout of the date column. Dates without a time zone are in UTC.
+	DateFormat string `yaml:"date_format"`
+
+	// BuyValues and SellValues are the values of the side column, compared case-insensitively.
+	BuyValues  []string `yaml:"buy_values"`
+	SellValues []string `yaml:"sell_values"`
+
+	// Delimiter is the field delimiter, a comma when it is empty.
+	Delimiter string `yaml:"delimiter"`
+}
+
+// IdempotencyConfig holds the settings of the idempotency keys of the order submissions.
+type IdempotencyConfig struct {
+	// TTL is how long a key replays its original response. Expired keys can be reused.
+	TTL time.Duration `yaml:"ttl"`
+
+	// LockTimeout is how long a request in progress holds its key. A retry takes over the keys
+	// held longer, whose request was lost to a crash.
+	LockTimeout time.Duration `yaml:"lock_timeout"`
+}
+
+// Default returns the configuration with all default values set.
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			ReadTimeout:     DEFAULT_READ_TIMEOUT,
+			WriteTimeout:    DEFAULT_WRITE_TIMEOUT,
+			IdleTimeout:     DEFAULT_IDLE_TIMEOUT,
+			ShutdownTimeout: DEFAULT_SHUTDOWN_TIMEOUT,
+		},
+		Database: DatabaseConfig{
+			MaxOpenConns:    DEFAULT_MAX_OPEN_CONNS,
+			MaxIdleConns:    DEFAULT_MAX_IDLE_CONNS,
+			ConnMaxLifetime: DEFAULT_CONN_MAX_LIFETIME,
+		},
+		Quotes: QuotesConfig{
+			BaseURI: DEFAULT_QUOTES_BASE_URI,
+			Timeout: DEFAULT_QUOTES_TIMEOUT,
+		},
+		Scheduler: SchedulerConfig{
+			StatsInterval:    DEFAULT_STATS_INTERVAL,
+			StatsConcurrency: DEFAULT_STATS_CONCURRENCY,
+		},
+		Auth: AuthConfig{
+			TokenTTL: DEFAULT_AUTH_TOKEN_TTL,
+		},
+		Billing: BillingConfig{
+			Gateway:    DEFAULT_BILLING_GATEWAY,
+			Interval:   DEFAULT_BILLING_INTERVAL,
+			InvoiceDue: DEFAULT_INVOICE_DUE,
+		},
+		Notify: NotifyConfig{
+			SMTPPort:       DEFAULT_SMTP_PORT,
+			WebhookTimeout: DEFAULT_WEBHOOK_TIMEOUT,
+			MaxAttempts:    DEFAULT_NOTIFY_ATTEMPTS,
+			RetryBackoff:   DEFAULT_NOTIFY_BACKOFF,
+			Workers:        DEFAULT_NOTIFY_WORKERS,
+		},
+		Webhooks: WebhooksConfig{
+			Timeout:      DEFAULT_WEBHOOK_TIMEOUT,
+			MaxAttempts:  DEFAULT_WEBHOOK_ATTEMPTS,
+			RetryBackoff: DEFAULT_WEBHOOK_BACKOFF,
+			Workers:      DEFAULT_WEBHOOK_WORKERS,
+		},
+		Ranking: RankingConfig{
+			Interval:   DEFAULT_RANKING_INTERVAL,
+			MinHistory: DEFAULT_RANKING_HISTORY,
+			MinTrades:  DEFAULT_RANKING_TRADES,
+			Weights: RankingWeights{
+				RiskAdjustedReturn: 0.4,
+				Drawdown:           0.2,
+				TrackRecord:        0.15,
+				Trades:             0.1,
+				Subscribers:        0.15,
+			},
+		},
+		Import: ImportConfig{
+			Mappings: map[string]ImportMapping{
+				DEFAULT_IMPORT_MAPPING: {
+					Date:       "date",
+					Side:       "side",
+					Symbol:     "symbol",
+					Quantity:   "quantity",
+					Price:      "price",
+					Fees:       "fees",
+					DateFormat: DEFAULT_IMPORT_DATE_FORMAT,
+					BuyValues:  []string{"buy", "b", "bot", "bought"},
+					SellValues: []string{"sell", "s", "sld", "sold"},
+				},
+			},
+			MaxRows: DEFAULT_IMPORT_MAX_ROWS,
+		},
+		Idempotency: IdempotencyConfig{
+			TTL:         DEFAULT_IDEMPOTENCY_TTL,
+			LockTimeout: DEFAULT_IDEMPOTENCY_LOCK,
+		},
+	}
+}
+
+// Load reads the configuration starting from the defaults, then the YAML file
+// given by $STOCKSIGNALS_CONFIG if it is set, then the environment variables.
+// The resulting configuration is validated before it is returned.
+func Load() (*Config, error) {
+	return LoadFile(os.Getenv(CONFIG_FILE_ENV))
+}
+
+// LoadFile is like Load but reads the YAML file at the given path, if it is not empty.
+func LoadFile(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file %s : %s", path, err)
+		}
+
+		if err = yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse config file %s : %s", path, err)
+		}
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func (cfg *Config) loadEnv() error {
+	var errs []string
+	setString := func(name string, value *string) {
+		if env := os.Getenv(name); env != "" {
+			*value = env
+		}
+	}
+	setInt := func(name string, value *int) {
+		if env := os.Getenv(name); env != "" {
+			i, err := strconv.Atoi(env)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("$%s must be an integer", name))
+				return
+			}
+			*value = i
+		}
+	}
+	setDuration := func(name string, value *time.Duration) {
+		if env := os.Getenv(name); env != "" {
+			d, err := time.ParseDuration(env)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("$%s must be a duration", name))
+				return
+			}
+			*value = d
+		}
+	}
+
+	setString("PORT", &cfg.Port)
+
+	setDuration("SERVER_READ_TIMEOUT", &cfg.Server.ReadTimeout)
+	setDuration("SERVER_WRITE_TIMEOUT", &cfg.Server.WriteTimeout)
+	setDuration("SERVER_IDLE_TIMEOUT", &cfg.Server.IdleTimeout)
+	setDuration("SERVER_SHUTDOWN_TIMEOUT", &cfg.Server.ShutdownTimeout)
+
+	setString("DATABASE_URL", &cfg.Database.URL)
+	setInt("DATABASE_MAX_OPEN_CONNS", &cfg.Database.MaxOpenConns)
+	setInt("DATABASE_MAX_IDLE_CONNS", &cfg.Database.MaxIdleConns)
+	setDuration("DATABASE_CONN_MAX_LIFETIME", &cfg.Database.ConnMaxLifetime)
+
+	setString("QUOTES_BASE_URI", &cfg.Quotes.BaseURI)
+	setDuration("QUOTES_TIMEOUT", &cfg.Quotes.Timeout)
+
+	setDuration("STATS_INTERVAL", &cfg.Scheduler.StatsInterval)
+	setInt("STATS_CONCURRENCY", &cfg.Scheduler.StatsConcurrency)
+
+	setString("AUTH_TOKEN_SECRET", &cfg.Auth.TokenSecret)
+	setDuration("AUTH_TOKEN_TTL", &cfg.Auth.TokenTTL)
+
+	setString("BILLING_GATEWAY", &cfg.Billing.Gateway)
+	setDuration("BILLING_INTERVAL", &cfg.Billing.Interval)
+	setDuration("BILLING_INVOICE_DUE", &cfg.Billing.InvoiceDue)
+
+	setString("SMTP_HOST", &cfg.Notify.SMTPHost)
+	setInt("SMTP_PORT", &cfg.Notify.SMTPPort)
+	setString("SMTP_USERNAME", &cfg.Notify.SMTPUsername)
+	setString("SMTP_PASSWORD", &cfg.Notify.SMTPPassword)
+	setString("EMAIL_FROM", &cfg.Notify.EmailFrom)
+	setDuration("WEBHOOK_TIMEOUT", &cfg.Notify.WebhookTimeout)
+	setInt("NOTIFY_MAX_ATTEMPTS", &cfg.Notify.MaxAttempts)
+	setDuration("NOTIFY_RETRY_BACKOFF", &cfg.Notify.RetryBackoff)
+	setInt("NOTIFY_WORKERS", &cfg.Notify.Workers)
+
+	setDuration("WEBHOOKS_TIMEOUT", &cfg.Webhooks.Timeout)
+	setInt("WEBHOOKS_MAX_ATTEMPTS", &cfg.Webhooks.MaxAttempts)
+	setDuration("WEBHOOKS_RETRY_BACKOFF", &cfg.Webhooks.RetryBackoff)
+	setInt("WEBHOOKS_WORKERS", &cfg.Webhooks.Workers)
+
+	setDuration("RANKING_INTERVAL", &cfg.Ranking.Interval)
+	setDuration("RANKING_MIN_HISTORY", &cfg.Ranking.MinHistory)
+	setInt("RANKING_MIN_TRADES", &cfg.Ranking.MinTrades)
+
+	setInt("IMPORT_MAX_ROWS", &cfg.Import.MaxRows)
+
+	setDuration("IDEMPOTENCY_TTL", &cfg.Idempotency.TTL)
+	setDuration("IDEMPOTENCY_LOCK_TIMEOUT", &cfg.Idempotency.LockTimeout)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid environment : %s", strings.Join(errs, ", "))
+	}
+
+	return nil
+}
+
+// Validate checks that the required values are set and the others are in range.
+func (cfg *Config) Validate() error {
+	var errs []string
+	if cfg.Port == "" {
+		errs = append(errs, "port must be set ($PORT)")
+	}
+
+	if cfg.Database.URL == "" {
+		errs = append(errs, "database url must be set ($DATABASE_URL)")
+	}
+
+	if cfg.Database.MaxOpenConns < 0 || cfg.Database.MaxIdleConns < 0 {
+		errs = append(errs, "database connection limits cannot be negative")
+	}
+
+	if !strings.Contains(cfg.Quotes.BaseURI, "%s") {
+		errs = append(errs, "quotes base uri must contain a %s verb for the symbols")
+	}
+
+	if cfg.Quotes.Timeout <= 0 {
+		errs = append(errs, "quotes timeout must be positive")
+	}
+
+	if cfg.Scheduler.StatsInterval <= 0 {
+		errs = append(errs, "stats interval must be positive")
+	}
+
+	if cfg.Scheduler.StatsConcurrency <= 0 {
+		errs = append(errs, "stats concurrency must be positive")
+	}
+
+	if len(cfg.Auth.TokenSecret) < MIN_AUTH_TOKEN_SECRET_SIZE {
+		errs = append(errs, fmt.Sprintf("auth token secret must be at least %d characters ($AUTH_TOKEN_SECRET)", MIN_AUTH_TOKEN_SECRET_SIZE))
+	}
+
+	if cfg.Auth.TokenTTL <= 0 {
+		errs = append(errs, "auth token ttl must be positive")
+	}
+
+	if cfg.Billing.Gateway == "" {
+		errs = append(errs, "billing gateway must be set")
+	}
+
+	if cfg.Billing.Interval <= 0 || cfg.Billing.InvoiceDue <= 0 {
+		errs = append(errs, "billing interval and invoice due must be positive")
+	}
+
+	if cfg.Notify.SMTPHost != "" && cfg.Notify.EmailFrom == "" {
+		errs = append(errs, "email from address must be set when smtp host is set ($EMAIL_FROM)")
+	}
+
+	if cfg.Notify.WebhookTimeout <= 0 || cfg.Notify.RetryBackoff <= 0 {
+		errs = append(errs, "notification webhook timeout and retry backoff must be positive")
+	}
+
+	if cfg.Notify.MaxAttempts <= 0 || cfg.Notify.Workers <= 0 {
+		errs = append(errs, "notification attempts and workers must be positive")
+	}
+
+	if cfg.Webhooks.Timeout <= 0 || cfg.Webhooks.RetryBackoff <= 0 {
+		errs = append(errs, "webhooks timeout and retry backoff must be positive")
+	}
+
+	if cfg.Webhooks.MaxAttempts <= 0 || cfg.Webhooks.Workers <= 0 {
+		errs = append(errs, "webhooks attempts and workers must be positive")
+	}
+
+	if cfg.Ranking.Interval <= 0 {
+		errs = append(errs, "ranking interval must be positive")
+	}
+
+	if cfg.Ranking.MinHistory < 0 || cfg.Ranking.MinTrades < 0 {
+		errs = append(errs, "ranking minimum history and trades must not be negative")
+	}
+
+	w := cfg.Ranking.Weights
+	if w.RiskAdjustedReturn < 0 || w.Drawdown < 0 || w.TrackRecord < 0 || w.Trades < 0 || w.Subscribers < 0 ||
+		w.RiskAdjustedReturn+w.Drawdown+w.TrackRecord+w.Trades+w.Subscribers == 0 {
+		errs = append(errs, "ranking weights must not be negative and must not all be 0")
+	}
+
+	if cfg.Idempotency.TTL <= 0 {
+		errs = append(errs, "idempotency ttl must be positive")
+	}
+
+	if cfg.Idempotency.LockTimeout <= 0 || cfg.Idempotency.LockTimeout > cfg.Idempotency.TTL {
+		errs = append(errs, "idempotency lock timeout must be positive and at most the ttl")
+	}
+
+	if cfg.Import.MaxRows <= 0 {
+		errs = append(errs, "import max rows must be positive")
+	}
+
+	for name, m := range cfg.Import.Mappings {
+		if m.Date == "" || m.Symbol == "" || m.Quantity == "" || m.Price == "" || m.DateFormat == "" {
+			errs = append(errs, fmt.Sprintf("import mapping %s must set the date, symbol, quantity, price columns and the date format", name))
+		}
+
+		if m.Side != "" && (len(m.BuyValues) == 0 || len(m.SellValues) == 0) {
+			errs = append(errs, fmt.Sprintf("import mapping %s must set the buy and sell values of its side column", name))
+		}
+
+		if len([]rune(m.Delimiter)) > 1 {
+			errs = append(errs, fmt.Sprintf("import mapping %s delimiter must be a single character", name))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration : %s", strings.Join(errs, ", "))
+	}
+
+	return nil
+}
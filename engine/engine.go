@@ -0,0 +1,167 @@
+// Package engine registers the orders and stats of the signals and publishes
+// their changes to the notifications, the webhooks and the streams. It is
+// shared by the web server and the command line tool, so that the changes are
+// published whichever way they are made.
+package engine
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/heroku/stocksignals/config"
+	"github.com/heroku/stocksignals/events"
+	"github.com/heroku/stocksignals/model"
+	"github.com/heroku/stocksignals/notify"
+	"github.com/heroku/stocksignals/store"
+	"github.com/heroku/stocksignals/webhook"
+)
+
+const (
+	// NOTIFICATION_BUFFER is the number of events waiting for the notification dispatcher.
+	NOTIFICATION_BUFFER = 256
+
+	// WEBHOOK_BUFFER is the number of events waiting for the webhook deliverer.
+	WEBHOOK_BUFFER = 256
+)
+
+// Bus publishes the changes on the signals to the notifications, the webhooks and the streams.
+var Bus = events.NewBus()
+
+// RegisterOrders registers the given orders of the given user, then publishes them
+// with the new portfolios and stats of their signals. It returns the registered orders.
+func RegisterOrders(orders []model.Order, userID int) ([]model.Order, error) {
+	registered, err := store.RegisterOrders(orders, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	PublishOrders(registered)
+	return registered, nil
+}
+
+// SaveAllStats saves new stats for all the signals with at most concurrency workers,
+// then publishes the saved stats and portfolios.
+func SaveAllStats(concurrency int) (*store.StatsSnapshot, error) {
+	signals, err := store.GetAllSignals()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot, err := store.SaveSignalsStats(signals, concurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, signalID := range snapshot.Saved {
+		PublishStats(signalID)
+	}
+
+	return snapshot, nil
+}
+
+// PublishOrders publishes the given registered orders, then the new
+// portfolios and stats of their signals.
+func PublishOrders(orders []model.Order) {
+	for _, order := range orders {
+		Bus.Publish(events.New(events.ORDER, order.SignalID, order))
+	}
+
+	for _, signalID := range OrderSignalIDs(orders) {
+		PublishStats(signalID)
+	}
+}
+
+// PublishStats publishes the latest stats of the given signal and its
+// portfolio valued with those stats.
+func PublishStats(signalID int) {
+	stats, err := store.GetLatestStats(signalID)
+	if err != nil || stats == nil {
+		log.Printf("failed to publish stats of signal %d : %v", signalID, err)
+		return
+	}
+
+	holdings, err := store.GetHoldingsBySignalID(signalID, "", true)
+	if err != nil {
+		log.Printf("failed to publish portfolio of signal %d : %s", signalID, err)
+		return
+	}
+
+	Bus.Publish(events.New(events.STATS, signalID, stats))
+	Bus.Publish(events.New(events.PORTFOLIO, signalID, model.Portfolio{Stats: *stats, Holdings: holdings}))
+}
+
+// PublishSkippedCopy publishes the given skipped copy of an order of the given leader signal.
+func PublishSkippedCopy(leaderID int, trade model.CopyTrade) {
+	Bus.Publish(events.New(events.COPY_SKIPPED, leaderID, trade))
+}
+
+// OrderSignalIDs returns the distinct signal ids of the given orders
+func OrderSignalIDs(orders []model.Order) []int {
+	var ids []int
+	seen := make(map[int]bool)
+	for _, order := range orders {
+		if !seen[order.SignalID] {
+			seen[order.SignalID] = true
+			ids = append(ids, order.SignalID)
+		}
+	}
+	return ids
+}
+
+// Delivery delivers the events published on the bus to the notification channels of the
+// subscribers and to the webhooks.
+type Delivery struct {
+	// Webhooks is the webhook deliverer, which also replays the dead letters.
+	Webhooks *webhook.Deliverer
+
+	notifications *events.Subscription
+	webhookEvents *events.Subscription
+	wg            sync.WaitGroup
+}
+
+// StartDelivery starts delivering the events published from now on with the given configuration,
+// until the given context is done or the delivery is closed.
+func StartDelivery(ctx context.Context, cfg *config.Config) *Delivery {
+	d := &Delivery{
+		Webhooks:      webhook.NewDeliverer(cfg.Webhooks.Timeout, cfg.Webhooks.MaxAttempts, cfg.Webhooks.RetryBackoff, cfg.Webhooks.Workers),
+		notifications: Bus.Subscribe(0, NOTIFICATION_BUFFER),
+		webhookEvents: Bus.Subscribe(0, WEBHOOK_BUFFER),
+	}
+	dispatcher := newDispatcher(cfg.Notify)
+
+	d.wg.Add(2)
+	go func() {
+		defer d.wg.Done()
+		dispatcher.Run(ctx, d.notifications)
+	}()
+
+	go func() {
+		defer d.wg.Done()
+		d.Webhooks.Run(ctx, d.webhookEvents)
+	}()
+
+	return d
+}
+
+// Close stops the delivery once the events already published are delivered, or right away if its
+// context is done, and waits for the running deliveries.
+func (d *Delivery) Close() {
+	d.notifications.Close()
+	d.webhookEvents.Close()
+	d.wg.Wait()
+}
+
+// newDispatcher creates the notification dispatcher with the configured channels.
+// Email notifications are only available if an SMTP server is configured.
+func newDispatcher(cfg config.NotifyConfig) *notify.Dispatcher {
+	channels := map[string]notify.Channel{
+		model.WEBHOOK: notify.NewWebhookChannel(cfg.WebhookTimeout),
+	}
+
+	if cfg.SMTPHost != "" {
+		channels[model.EMAIL] = notify.NewSMTPChannel(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.EmailFrom)
+	}
+
+	return notify.NewDispatcher(channels, cfg.MaxAttempts, cfg.RetryBackoff, cfg.Workers)
+}
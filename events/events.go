@@ -0,0 +1,104 @@
+package events
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// ORDER is the type of the events published when an order is registered.
+	ORDER = "order"
+
+	// PORTFOLIO is the type of the events published when the holdings of a
+	// signal change or are revalued with the current prices.
+	PORTFOLIO = "portfolio"
+
+	// STATS is the type of the events published when new stats of a signal are saved.
+	STATS = "stats"
+
+	// COPY_SKIPPED is the type of the events published on a leader signal when one of its
+	// orders cannot be copied to a follower.
+	COPY_SKIPPED = "copy_trade.skipped"
+)
+
+// Event is a change on a signal.
+type Event struct {
+	Type     string      `json:"type"`
+	SignalID int         `json:"signal_id"`
+	Time     int64       `json:"time"`
+	Data     interface{} `json:"data"`
+}
+
+// New creates an event of the given type for the given signal at the current time.
+func New(eventType string, signalID int, data interface{}) Event {
+	return Event{Type: eventType, SignalID: signalID, Time: time.Now().Unix(), Data: data}
+}
+
+// Bus delivers the published events to the subscriptions of their signals.
+type Bus struct {
+	mutex         sync.RWMutex
+	nextID        int
+	subscriptions map[int]*Subscription
+}
+
+// Subscription receives the events of a signal, or of all signals, on C.
+type Subscription struct {
+	C <-chan Event
+
+	c        chan Event
+	id       int
+	signalID int
+	bus      *Bus
+}
+
+// NewBus creates an event bus without subscriptions.
+func NewBus() *Bus {
+	return &Bus{subscriptions: make(map[int]*Subscription)}
+}
+
+// Subscribe creates a subscription to the events of the given signal, or of
+// all signals if signalID is 0, which buffers up to size events.
+func (b *Bus) Subscribe(signalID, size int) *Subscription {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.nextID++
+	c := make(chan Event, size)
+	subscription := &Subscription{C: c, c: c, id: b.nextID, signalID: signalID, bus: b}
+	b.subscriptions[subscription.id] = subscription
+
+	return subscription
+}
+
+// Publish delivers the given event to the subscriptions of its signal without
+// blocking. Subscriptions whose buffers are full miss the event.
+func (b *Bus) Publish(event Event) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	for _, subscription := range b.subscriptions {
+		if subscription.signalID != 0 && subscription.signalID != event.SignalID {
+			continue
+		}
+
+		select {
+		case subscription.c <- event:
+		default:
+			log.Printf("dropped %s event of signal %d for a slow subscription", event.Type, event.SignalID)
+		}
+	}
+}
+
+// Close removes the subscription from its bus and closes C.
+func (s *Subscription) Close() {
+	s.bus.mutex.Lock()
+	defer s.bus.mutex.Unlock()
+
+	if _, ok := s.bus.subscriptions[s.id]; !ok {
+		return
+	}
+
+	delete(s.bus.subscriptions, s.id)
+	close(s.c)
+}
@@ -0,0 +1,282 @@
+// Package export writes the history of a signal for the auditors and the
+// analysts: its orders, its current holdings and its stats history, each as
+// CSV or JSON Lines, or all of them in a zip bundle with a manifest. The rows
+// are streamed from the store as they are written.
+package export
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/heroku/stocksignals/model"
+	"github.com/heroku/stocksignals/store"
+)
+
+const (
+	// CSV writes a dataset as comma separated values with a header row.
+	CSV = "csv"
+
+	// JSONL writes a dataset as JSON Lines, one object per row.
+	JSONL = "jsonl"
+
+	// ZIP writes all the datasets and a manifest in a zip bundle.
+	ZIP = "zip"
+
+	// ORDERS is the dataset of the orders of a signal, in time order.
+	ORDERS = "orders"
+
+	// HOLDINGS is the dataset of the current holdings of a signal.
+	HOLDINGS = "holdings"
+
+	// STATS is the dataset of the stats history of a signal, in time order.
+	STATS = "stats"
+
+	// MANIFEST_FILE is the name of the manifest in the zip bundles.
+	MANIFEST_FILE = "manifest.json"
+)
+
+var (
+	// FORMATS are the formats of the datasets.
+	FORMATS = []string{CSV, JSONL}
+
+	// DATASETS are the datasets of a signal, in bundle order.
+	DATASETS = []string{ORDERS, HOLDINGS, STATS}
+)
+
+// Manifest describes the signal and the files of a zip bundle.
+type Manifest struct {
+	SignalID      int            `json:"signal_id"`
+	SignalName    string         `json:"signal_name"`
+	Format        string         `json:"format"`
+	GeneratedTime int64          `json:"generated_time"`
+	Files         []ManifestFile `json:"files"`
+}
+
+// ManifestFile describes a dataset file of a zip bundle. SHA256 is the hex digest of its content.
+type ManifestFile struct {
+	Name    string `json:"name"`
+	Dataset string `json:"dataset"`
+	Rows    int    `json:"rows"`
+	SHA256  string `json:"sha256"`
+}
+
+// dataset lists the columns of a dataset and calls fn with the values of each of its rows
+type dataset struct {
+	columns []string
+	each    func(signalID int, fn func(values ...interface{}) error) error
+}
+
+var datasets = map[string]dataset{
+	ORDERS: {
+		columns: []string{"id", "order_time", "type", "code", "name", "num_shares", "price", "profit"},
+		each: func(signalID int, fn func(values ...interface{}) error) error {
+			return store.EachOrder(signalID, func(o model.Order) error {
+				return fn(o.ID, o.Time, o.Type, o.Code, o.Name, o.NumShares, o.Price, o.Profit)
+			})
+		},
+	},
+	HOLDINGS: {
+		columns: []string{"id", "code", "name", "num_shares", "price"},
+		each: func(signalID int, fn func(values ...interface{}) error) error {
+			holdings, err := store.GetHoldingsBySignalID(signalID, "code", false)
+			if err != nil {
+				return err
+			}
+
+			for _, h := range holdings {
+				if err = fn(h.ID, h.Code, h.Name, h.NumShares, h.Price); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	STATS: {
+		columns: []string{"id", "stats_time", "deposits", "withdrawals", "funds", "balance", "equity", "profit", "growth", "drawdown"},
+		each: func(signalID int, fn func(values ...interface{}) error) error {
+			return store.EachStats(signalID, func(s model.Stats) error {
+				return fn(s.ID, s.Time, s.Deposits, s.Withdrawals, s.Funds, s.Balance, s.Equity, s.Profit, s.Growth, s.Drawdown)
+			})
+		},
+	},
+}
+
+// Check returns a validation error if the given dataset or format is unknown.
+// The dataset is not checked when it is empty.
+func Check(dataset, format string) error {
+	if _, ok := datasets[dataset]; dataset != "" && !ok {
+		return store.Invalid("dataset", "dataset must be one of %v", DATASETS)
+	}
+
+	if format != CSV && format != JSONL {
+		return store.Invalid("format", "format must be one of %v", FORMATS)
+	}
+	return nil
+}
+
+// ContentType returns the media type of the given format.
+func ContentType(format string) string {
+	switch format {
+	case CSV:
+		return "text/csv; charset=utf-8"
+	case JSONL:
+		return "application/x-ndjson"
+	case ZIP:
+		return "application/zip"
+	}
+	return "application/octet-stream"
+}
+
+// Filename returns the name of the file of the given dataset of the given signal,
+// or of its bundle when the dataset is empty.
+func Filename(signalID int, dataset, format string) string {
+	if dataset == "" {
+		return fmt.Sprintf("signal-%d.%s", signalID, ZIP)
+	}
+	return fmt.Sprintf("signal-%d-%s.%s", signalID, dataset, format)
+}
+
+// WriteDataset writes the given dataset of the given signal to w in the given format,
+// CSV or JSONL, and returns the number of rows written.
+func WriteDataset(w io.Writer, signalID int, name, format string) (int, error) {
+	if err := Check(name, format); err != nil {
+		return 0, err
+	}
+
+	d := datasets[name]
+	var rows rowWriter
+	if format == CSV {
+		rows = &csvWriter{w: csv.NewWriter(w)}
+	} else {
+		rows = &jsonlWriter{enc: json.NewEncoder(w)}
+	}
+
+	if err := rows.header(d.columns); err != nil {
+		return 0, fmt.Errorf("failed to write %s header : %s", name, err)
+	}
+
+	count := 0
+	err := d.each(signalID, func(values ...interface{}) error {
+		count++
+		return rows.row(values)
+	})
+	if err != nil {
+		return count, fmt.Errorf("failed to write %s : %s", name, err)
+	}
+
+	if err = rows.flush(); err != nil {
+		return count, fmt.Errorf("failed to write %s : %s", name, err)
+	}
+	return count, nil
+}
+
+// WriteBundle writes a zip bundle to w with all the datasets of the given signal in the
+// given format and a manifest describing them, written last once the files are complete.
+func WriteBundle(w io.Writer, signal model.Signal, format string, now time.Time) error {
+	if err := Check("", format); err != nil {
+		return err
+	}
+
+	manifest := Manifest{SignalID: signal.ID, SignalName: signal.Name, Format: format, GeneratedTime: now.Unix()}
+	archive := zip.NewWriter(w)
+	for _, name := range DATASETS {
+		file := ManifestFile{Name: name + "." + format, Dataset: name}
+		f, err := archive.CreateHeader(&zip.FileHeader{Name: file.Name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return fmt.Errorf("failed to add %s to the bundle : %s", file.Name, err)
+		}
+
+		hash := sha256.New()
+		if file.Rows, err = WriteDataset(io.MultiWriter(f, hash), signal.ID, name, format); err != nil {
+			return err
+		}
+
+		file.SHA256 = hex.EncodeToString(hash.Sum(nil))
+		manifest.Files = append(manifest.Files, file)
+	}
+
+	f, err := archive.CreateHeader(&zip.FileHeader{Name: MANIFEST_FILE, Method: zip.Deflate, Modified: now})
+	if err != nil {
+		return fmt.Errorf("failed to add the manifest to the bundle : %s", err)
+	}
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(manifest); err != nil {
+		return fmt.Errorf("failed to write the manifest : %s", err)
+	}
+
+	if err = archive.Close(); err != nil {
+		return fmt.Errorf("failed to complete the bundle : %s", err)
+	}
+	return nil
+}
+
+// rowWriter writes the rows of a dataset in a format
+type rowWriter interface {
+	header(columns []string) error
+	row(values []interface{}) error
+	flush() error
+}
+
+type csvWriter struct {
+	w      *csv.Writer
+	record []string
+}
+
+func (c *csvWriter) header(columns []string) error {
+	return c.w.Write(columns)
+}
+
+func (c *csvWriter) row(values []interface{}) error {
+	c.record = c.record[:0]
+	for _, v := range values {
+		c.record = append(c.record, formatValue(v))
+	}
+	return c.w.Write(c.record)
+}
+
+func (c *csvWriter) flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type jsonlWriter struct {
+	enc     *json.Encoder
+	columns []string
+}
+
+func (j *jsonlWriter) header(columns []string) error {
+	j.columns = columns
+	return nil
+}
+
+func (j *jsonlWriter) row(values []interface{}) error {
+	object := make(map[string]interface{}, len(values))
+	for i, v := range values {
+		object[j.columns[i]] = v
+	}
+	return j.enc.Encode(object)
+}
+
+func (j *jsonlWriter) flush() error {
+	return nil
+}
+
+// formatValue formats the given value of a CSV cell, without exponent for the floats
+func formatValue(v interface{}) string {
+	switch value := v.(type) {
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case string:
+		return value
+	}
+	return fmt.Sprint(v)
+}
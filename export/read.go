@@ -0,0 +1,124 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/heroku/stocksignals/model"
+	"github.com/heroku/stocksignals/store"
+)
+
+// orderRow is a row of the orders dataset
+type orderRow struct {
+	Time      int64   `json:"order_time"`
+	Type      string  `json:"type"`
+	Code      string  `json:"code"`
+	Name      string  `json:"name"`
+	NumShares int     `json:"num_shares"`
+	Price     float64 `json:"price"`
+	Profit    float64 `json:"profit"`
+}
+
+// ReadOrders reads back an orders dataset written by WriteDataset in the given format, to
+// replay it on a signal. The orders are returned in the dataset order as past orders
+// without ids or signal. Their profit is only kept for the deposits and the withdrawals, whose amount
+// it is; the engine computes it again for the other orders.
+func ReadOrders(r io.Reader, format string) ([]model.Order, error) {
+	if err := Check(ORDERS, format); err != nil {
+		return nil, err
+	}
+
+	var rows []orderRow
+	var err error
+	if format == CSV {
+		rows, err = readOrdersCSV(r)
+	} else {
+		rows, err = readOrdersJSONL(r)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	orders := []model.Order{}
+	for _, row := range rows {
+		order := model.Order{Time: row.Time, Type: row.Type, Code: row.Code, Name: row.Name,
+			NumShares: row.NumShares, Price: row.Price, PastOrder: true}
+		if row.Type == model.DEPOSIT || row.Type == model.WITHDRAW {
+			order.Profit = row.Profit
+		}
+		orders = append(orders, order)
+	}
+
+	return orders, nil
+}
+
+func readOrdersJSONL(r io.Reader) ([]orderRow, error) {
+	var rows []orderRow
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var row orderRow
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			return nil, store.Invalid("", "invalid order on line %d : %s", line, err)
+		}
+		rows = append(rows, row)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read orders : %s", err)
+	}
+	return rows, nil
+}
+
+func readOrdersCSV(r io.Reader) ([]orderRow, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, store.Invalid("", "invalid orders header : %s", err)
+	}
+
+	index := make(map[string]int)
+	for i, column := range header {
+		index[column] = i
+	}
+
+	for _, column := range datasets[ORDERS].columns {
+		if _, ok := index[column]; !ok {
+			return nil, store.Invalid("", "the %s column is missing", column)
+		}
+	}
+
+	var rows []orderRow
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, store.Invalid("", "invalid order on line %d : %s", line, err)
+		}
+
+		var row orderRow
+		var errs [4]error
+		row.Type, row.Code, row.Name = record[index["type"]], record[index["code"]], record[index["name"]]
+		row.Time, errs[0] = strconv.ParseInt(record[index["order_time"]], 10, 64)
+		row.NumShares, errs[1] = strconv.Atoi(record[index["num_shares"]])
+		row.Price, errs[2] = strconv.ParseFloat(record[index["price"]], 64)
+		row.Profit, errs[3] = strconv.ParseFloat(record[index["profit"]], 64)
+		for _, err := range errs {
+			if err != nil {
+				return nil, store.Invalid("", "invalid order on line %d : %s", line, err)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
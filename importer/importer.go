@@ -0,0 +1,253 @@
+// Package importer reads the orders of a signal from broker CSV statements.
+// The columns of a statement are mapped to the order fields by a
+// config.ImportMapping, and the rows are normalized into past buy and sell
+// orders ready for the order engine.
+package importer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/heroku/stocksignals/config"
+	"github.com/heroku/stocksignals/model"
+	"github.com/heroku/stocksignals/store"
+	"github.com/heroku/stocksignals/validation"
+)
+
+// Parse reads the orders of the given signal from the CSV statement r, whose first row is the
+// header, with the given column mapping. The fees are included in the order prices: they raise
+// the price of the buys and lower the price of the sells. The orders are returned in time order,
+// the rows of a same time in statement order. All the invalid rows are reported together.
+func Parse(r io.Reader, mapping config.ImportMapping, signalID, maxRows int, now time.Time) ([]model.Order, error) {
+	reader := csv.NewReader(r)
+	if mapping.Delimiter != "" {
+		reader.Comma = []rune(mapping.Delimiter)[0]
+	}
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, store.Invalid("", "the statement is empty")
+	}
+	if err != nil {
+		return nil, store.Invalid("", "invalid statement : %s", err)
+	}
+
+	columns, err := mapColumns(header, mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	errs := make(validation.Errors)
+	var orders []model.Order
+	count := 0
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, store.Invalid("", "invalid statement : %s", err)
+		}
+
+		if blank(record) {
+			continue
+		}
+
+		if count++; count > maxRows {
+			return nil, store.Invalid("", "the statement has more than %d orders", maxRows)
+		}
+
+		order, rowErrs := parseRow(record, columns, mapping, now)
+		if len(rowErrs) > 0 {
+			errs.Merge(fmt.Sprintf("rows[%d].", row), rowErrs)
+			continue
+		}
+
+		order.SignalID = signalID
+		orders = append(orders, order)
+	}
+
+	if err = errs.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(orders) == 0 {
+		return nil, store.Invalid("", "the statement has no orders")
+	}
+
+	// Statements listing the latest orders first are replayed from the oldest one
+	if orders[0].Time > orders[len(orders)-1].Time {
+		for i, j := 0, len(orders)-1; i < j; i, j = i+1, j-1 {
+			orders[i], orders[j] = orders[j], orders[i]
+		}
+	}
+	sort.SliceStable(orders, func(i, j int) bool {
+		return orders[i].Time < orders[j].Time
+	})
+
+	return orders, nil
+}
+
+// columns holds the index of the mapped columns in the records, -1 for the optional columns which are not mapped
+type columns struct {
+	date, side, symbol, quantity, price, fees int
+}
+
+func mapColumns(header []string, mapping config.ImportMapping) (columns, error) {
+	index := make(map[string]int)
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	errs := make(validation.Errors)
+	find := func(field, name string) int {
+		if name == "" {
+			return -1
+		}
+
+		i, ok := index[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			// The statements without fees have no fees column
+			if field == "fees" {
+				return -1
+			}
+			errs.Add("mapping."+field, "column %q is missing from the statement", name)
+		}
+		return i
+	}
+
+	c := columns{
+		date:     find("date", mapping.Date),
+		side:     find("side", mapping.Side),
+		symbol:   find("symbol", mapping.Symbol),
+		quantity: find("quantity", mapping.Quantity),
+		price:    find("price", mapping.Price),
+		fees:     find("fees", mapping.Fees),
+	}
+	return c, errs.Err()
+}
+
+// parseRow normalizes the given row into a past order, without its signal
+func parseRow(record []string, c columns, mapping config.ImportMapping, now time.Time) (model.Order, validation.Errors) {
+	errs := make(validation.Errors)
+	field := func(i int) string {
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	order := model.Order{PastOrder: true}
+	date, err := time.ParseInLocation(mapping.DateFormat, field(c.date), time.UTC)
+	if err != nil {
+		errs.Add("date", "invalid date %q, expected the %s format", field(c.date), mapping.DateFormat)
+	} else if !date.Before(now) {
+		errs.Add("date", "must be in the past")
+	} else {
+		order.Time = date.Unix()
+	}
+
+	order.Code = strings.ToUpper(field(c.symbol))
+	if err = validation.Symbol(order.Code); err != nil {
+		errs.Add("symbol", "%s", err)
+	}
+
+	quantity, err := parseNumber(field(c.quantity))
+	if err != nil || quantity == 0 || quantity != math.Trunc(quantity) || math.Abs(quantity) > math.MaxInt32 {
+		errs.Add("quantity", "invalid quantity %q, expected a whole number of shares", field(c.quantity))
+	}
+	order.NumShares = int(math.Abs(quantity))
+
+	switch {
+	case c.side < 0 && quantity < 0:
+		order.Type = model.SELL
+	case c.side < 0:
+		order.Type = model.BUY
+	case matches(field(c.side), mapping.BuyValues):
+		order.Type = model.BUY
+	case matches(field(c.side), mapping.SellValues):
+		order.Type = model.SELL
+	default:
+		errs.Add("side", "unknown side %q", field(c.side))
+	}
+
+	price, err := parseNumber(field(c.price))
+	if err != nil || price <= 0 {
+		errs.Add("price", "invalid price %q", field(c.price))
+	}
+
+	var fees float64
+	if str := field(c.fees); str != "" {
+		if fees, err = parseNumber(str); err != nil {
+			errs.Add("fees", "invalid fees %q", str)
+		}
+		fees = math.Abs(fees)
+	}
+
+	if len(errs) > 0 {
+		return order, errs
+	}
+
+	if order.Type == model.BUY {
+		order.Price = price + fees/float64(order.NumShares)
+	} else {
+		order.Price = price - fees/float64(order.NumShares)
+	}
+
+	if order.Price <= 0 {
+		errs.Add("fees", "must be less than the proceeds of the sale")
+	}
+	return order, errs
+}
+
+// parseNumber parses the given amount, ignoring the currency symbols and thousands
+// separators. Amounts between parentheses are negative, as in accounting statements.
+func parseNumber(str string) (float64, error) {
+	negative := strings.HasPrefix(str, "(") && strings.HasSuffix(str, ")")
+	if negative {
+		str = str[1 : len(str)-1]
+	}
+
+	str = strings.Map(func(r rune) rune {
+		switch r {
+		case ',', '$', '€', '£', ' ':
+			return -1
+		}
+		return r
+	}, str)
+
+	n, err := strconv.ParseFloat(str, 64)
+	if negative {
+		n = -n
+	}
+	return n, err
+}
+
+func matches(value string, values []string) bool {
+	for _, v := range values {
+		if strings.EqualFold(value, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func blank(record []string) bool {
+	for _, field := range record {
+		if strings.TrimSpace(field) != "" {
+			return false
+		}
+	}
+	return true
+}
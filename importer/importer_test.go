@@ -0,0 +1,201 @@
+package importer
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/heroku/stocksignals/config"
+	"github.com/heroku/stocksignals/model"
+	"github.com/heroku/stocksignals/store"
+)
+
+var now = time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+// parsed is the part of an imported order checked by the tests
+type parsed struct {
+	date   string
+	side   string
+	symbol string
+	shares int
+	price  float64
+}
+
+func defaultMapping() config.ImportMapping {
+	return config.Default().Import.Mappings[config.DEFAULT_IMPORT_MAPPING]
+}
+
+func TestParse(t *testing.T) {
+	withoutSide := defaultMapping()
+	withoutSide.Side = ""
+
+	tests := []struct {
+		name      string
+		mapping   config.ImportMapping
+		statement string
+		want      []parsed
+	}{
+		{
+			"buys and sells",
+			defaultMapping(),
+			"date,side,symbol,quantity,price\n2024-01-02,buy,aapl,10,100\n2024-01-03,SOLD,AAPL,4,110\n",
+			[]parsed{{"2024-01-02", model.BUY, "AAPL", 10, 100}, {"2024-01-03", model.SELL, "AAPL", 4, 110}},
+		},
+		{
+			"fees raise the buy price and lower the sell price",
+			defaultMapping(),
+			"date,side,symbol,quantity,price,fees\n2024-01-02,buy,MSFT,10,100,5\n2024-01-03,sell,MSFT,10,110,-5\n",
+			[]parsed{{"2024-01-02", model.BUY, "MSFT", 10, 100.5}, {"2024-01-03", model.SELL, "MSFT", 10, 109.5}},
+		},
+		{
+			"negative quantities are sells without a side column",
+			withoutSide,
+			"date,symbol,quantity,price\n2024-01-02,IBM,20,150\n2024-01-03,IBM,-5,155\n",
+			[]parsed{{"2024-01-02", model.BUY, "IBM", 20, 150}, {"2024-01-03", model.SELL, "IBM", 5, 155}},
+		},
+		{
+			"parenthesized amounts are negative",
+			withoutSide,
+			"date,symbol,quantity,price\n2024-01-03,IBM,(5),155\n",
+			[]parsed{{"2024-01-03", model.SELL, "IBM", 5, 155}},
+		},
+		{
+			"currency symbols and thousands separators are ignored",
+			defaultMapping(),
+			"date,side,symbol,quantity,price,fees\n2024-01-02,b,BRK.A,\"1,000\",\"$1,250.50\",€0\n",
+			[]parsed{{"2024-01-02", model.BUY, "BRK.A", 1000, 1250.5}},
+		},
+		{
+			"byte order mark",
+			defaultMapping(),
+			"\ufeffdate,side,symbol,quantity,price\n2024-01-02,buy,AAPL,1,100\n",
+			[]parsed{{"2024-01-02", model.BUY, "AAPL", 1, 100}},
+		},
+		{
+			"reverse-ordered statements are replayed from the oldest order",
+			defaultMapping(),
+			"date,side,symbol,quantity,price\n2024-01-03,sell,AAPL,1,110\n2024-01-02,buy,AAPL,2,100\n2024-01-02,buy,MSFT,3,200\n",
+			[]parsed{{"2024-01-02", model.BUY, "MSFT", 3, 200}, {"2024-01-02", model.BUY, "AAPL", 2, 100}, {"2024-01-03", model.SELL, "AAPL", 1, 110}},
+		},
+		{
+			"orders of a same time keep the statement order",
+			defaultMapping(),
+			"date,side,symbol,quantity,price\n2024-01-02,buy,AAPL,2,100\n2024-01-02,buy,MSFT,3,200\n2024-01-03,sell,AAPL,1,110\n",
+			[]parsed{{"2024-01-02", model.BUY, "AAPL", 2, 100}, {"2024-01-02", model.BUY, "MSFT", 3, 200}, {"2024-01-03", model.SELL, "AAPL", 1, 110}},
+		},
+		{
+			"header names are case insensitive and blank rows are skipped",
+			defaultMapping(),
+			"Date, Side ,SYMBOL,Quantity,Price\n\n2024-01-02,buy,AAPL,1,100\n,,,,\n",
+			[]parsed{{"2024-01-02", model.BUY, "AAPL", 1, 100}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			orders, err := Parse(strings.NewReader(test.statement), test.mapping, 7, 100, now)
+			if err != nil {
+				t.Fatalf("Parse() returned error %v", err)
+			}
+
+			got := []parsed{}
+			for _, order := range orders {
+				if order.SignalID != 7 || !order.PastOrder {
+					t.Errorf("order %+v is not a past order of signal 7", order)
+				}
+				got = append(got, parsed{time.Unix(order.Time, 0).UTC().Format("2006-01-02"), order.Type, order.Code, order.NumShares, math.Round(order.Price*1e6) / 1e6})
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Parse() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		statement string
+		fields    []string
+	}{
+		{
+			"all the invalid rows are reported",
+			"date,side,symbol,quantity,price,fees\n" +
+				"2024-01-02,buy,AAPL,1,100,0\n" +
+				"01/02/2024,hold,AAPL,1.5,-3,x\n" +
+				"2024-01-03,sell,,10,1,20\n" +
+				"2030-01-01,buy,AAPL,1,100,0\n",
+			[]string{"rows[2].date", "rows[2].side", "rows[2].quantity", "rows[2].price", "rows[2].fees", "rows[3].symbol", "rows[4].date"},
+		},
+		{
+			"fees above the proceeds of a sale",
+			"date,side,symbol,quantity,price,fees\n2024-01-03,sell,AAPL,1,10,20\n",
+			[]string{"rows[1].fees"},
+		},
+		{
+			"missing columns",
+			"date,symbol,qty,price\n2024-01-02,AAPL,1,100\n",
+			[]string{"mapping.side", "mapping.quantity"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(test.statement), defaultMapping(), 7, 100, now)
+			e, ok := err.(*store.Error)
+			if !ok || e.Code != store.VALIDATION {
+				t.Fatalf("Parse() returned error %v, want a validation error", err)
+			}
+
+			if len(e.Fields) != len(test.fields) {
+				t.Errorf("Parse() reported %v, want %v", e.Fields, test.fields)
+			}
+			for _, field := range test.fields {
+				if e.Fields[field] == "" {
+					t.Errorf("Parse() did not report %s in %v", field, e.Fields)
+				}
+			}
+		})
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	statements := []string{
+		"",
+		"date,side,symbol,quantity,price\n",
+		"date,side,symbol,quantity,price\n2024-01-02,buy,AAPL,1,100\n2024-01-03,buy,AAPL,1,100\n2024-01-04,buy,AAPL,1,100\n",
+	}
+
+	for _, statement := range statements {
+		if _, err := Parse(strings.NewReader(statement), defaultMapping(), 7, 2, now); store.ErrorCode(err) != store.VALIDATION {
+			t.Errorf("Parse(%q) returned error %v, want a validation error", statement, err)
+		}
+	}
+}
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		str  string
+		want float64
+	}{
+		{"12", 12},
+		{"-3.5", -3.5},
+		{"(3.5)", -3.5},
+		{"$1,234.56", 1234.56},
+		{"(£ 1,000)", -1000},
+		{"€7", 7},
+	}
+
+	for _, test := range tests {
+		if got, err := parseNumber(test.str); err != nil || got != test.want {
+			t.Errorf("parseNumber(%q) = %v, %v, want %v", test.str, got, err, test.want)
+		}
+	}
+
+	if _, err := parseNumber("ten"); err == nil {
+		t.Errorf("parseNumber(ten) returned no error")
+	}
+}
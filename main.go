@@ -1,9 +1,19 @@
 package main
 
 import (
-	"github.com/heroku/stocksignals/server"
+	_ "embed"
+	"log"
+	"os"
+
+	"github.com/heroku/stocksignals/cli"
 )
 
+//go:embed query_scripts/create_tables.sql
+var schema string
+
 func main() {
-	server.Run()
+	cli.Schema = schema
+	if err := cli.Run(os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,78 @@
+package model
+
+import "fmt"
+
+const (
+	// SIGNAL_UPDATE is the audit action of the signal metadata updates.
+	SIGNAL_UPDATE = "signal.update"
+
+	// SIGNAL_ARCHIVE is the audit action of the signal archivals.
+	SIGNAL_ARCHIVE = "signal.archive"
+
+	// SIGNAL_RESTORE is the audit action of the archived signal restorations.
+	SIGNAL_RESTORE = "signal.restore"
+
+	// SIGNAL_PURGE is the audit action of the signal purges. It is kept after the signal is deleted.
+	SIGNAL_PURGE = "signal.purge"
+
+	// ORDER_REGISTER is the audit action of the order registrations.
+	ORDER_REGISTER = "order.register"
+
+	// ORDER_DELETE is the audit action of the order deletions.
+	ORDER_DELETE = "order.delete"
+)
+
+// AuditEntry records who changed what on a signal. UserID is nil for the
+// changes made by the system, such as the orders copied to the followers.
+type AuditEntry struct {
+	ID       int      `json:"id" db:"id"`
+	UserID   *int     `json:"user_id" db:"user_id"`
+	SignalID int      `json:"signal_id" db:"signal_id"`
+	Action   string   `json:"action" db:"action"`
+	EntityID int      `json:"entity_id" db:"entity_id"`
+	Changes  JSONText `json:"changes" db:"changes"`
+	Time     int64    `json:"time" db:"audit_time"`
+}
+
+// JSONText is a JSON document stored in a text column.
+type JSONText []byte
+
+// MarshalJSON returns the document as is.
+func (j JSONText) MarshalJSON() ([]byte, error) {
+	if len(j) == 0 {
+		return []byte("null"), nil
+	}
+	return j, nil
+}
+
+// Scan reads the document from the database.
+func (j *JSONText) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		*j = append(JSONText{}, v...)
+	case string:
+		*j = JSONText(v)
+	case nil:
+		*j = nil
+	default:
+		return fmt.Errorf("cannot scan %T into JSONText", src)
+	}
+	return nil
+}
+
+// Change is the old and new value of a changed field.
+type Change struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// SignalUpdate holds the signal metadata to update. The nil fields are left unchanged.
+type SignalUpdate struct {
+	Name        *string  `json:"name"`
+	Description *string  `json:"description"`
+	Price       *float64 `json:"price"`
+	Tags        *Tags    `json:"tags"`
+
+	// Version is the version of the signal the update is based on, when no If-Match header is given.
+	Version int `json:"version"`
+}
@@ -0,0 +1,40 @@
+package model
+
+const (
+	// STOPPED is the status of a follower which does not copy the orders anymore.
+	STOPPED = "stopped"
+
+	// COPIED is the status of a leader order executed on a follower portfolio.
+	COPIED = "copied"
+
+	// SKIPPED is the status of a leader order which could not be executed on a follower portfolio.
+	SKIPPED = "skipped"
+)
+
+// Follower is the portfolio of a subscriber mirroring the orders of a signal.
+// The portfolio is held by a private signal owned by the subscriber.
+type Follower struct {
+	ID       int `json:"id" db:"id"`
+	UserID   int `json:"user_id" db:"user_id"`
+	LeaderID int `json:"leader_id" binding:"required" db:"leader_id"`
+	SignalID int `json:"signal_id" db:"signal_id"`
+
+	// Capital is deposited to the portfolio when the follower is created.
+	Capital float64 `json:"capital" binding:"required" db:"capital"`
+
+	// Slippage is the percentage added to the buy prices and removed from the sell prices of the copied orders.
+	Slippage    float64 `json:"slippage" db:"slippage"`
+	Status      string  `json:"status" db:"status"`
+	CreatedTime int64   `json:"created_time" db:"created_time"`
+}
+
+// CopyTrade is the outcome of mirroring a leader order on a follower portfolio.
+type CopyTrade struct {
+	ID            int    `json:"id" db:"id"`
+	FollowerID    int    `json:"follower_id" db:"follower_id"`
+	LeaderOrderID int    `json:"leader_order_id" db:"leader_order_id"`
+	OrderID       *int   `json:"order_id,omitempty" db:"order_id"`
+	Status        string `json:"status" db:"status"`
+	Reason        string `json:"reason,omitempty" db:"reason"`
+	Time          int64  `json:"time" db:"copy_time"`
+}
@@ -0,0 +1,17 @@
+package model
+
+// IdempotencyKey is the key a client sent with a request, with the hash of the request
+// and its response to replay on retries. Status is 0 while the request is in progress.
+type IdempotencyKey struct {
+	UserID      int    `json:"user_id" db:"user_id"`
+	Key         string `json:"key" db:"idempotency_key"`
+	RequestHash string `json:"request_hash" db:"request_hash"`
+	Status      int    `json:"status" db:"status"`
+	ContentType string `json:"content_type" db:"content_type"`
+	Response    string `json:"response" db:"response"`
+	CreatedTime int64  `json:"created_time" db:"created_time"`
+	ExpiresTime int64  `json:"expires_time" db:"expires_time"`
+
+	// LockedUntil is the end of the lease of a request in progress, after which a retry takes the key over.
+	LockedUntil int64 `json:"locked_until" db:"locked_until"`
+}
@@ -0,0 +1,48 @@
+package model
+
+const (
+	// UNPAID is the status of an invoice which is not paid yet.
+	UNPAID = "unpaid"
+
+	// PAID is the status of a paid invoice.
+	PAID = "paid"
+
+	// OVERDUE is the status of an unpaid invoice past its due time.
+	OVERDUE = "overdue"
+
+	// PENDING is the status of an invoice being charged by the payment gateway.
+	PENDING = "pending"
+)
+
+// Invoice is the charge of a subscription for a billing period.
+type Invoice struct {
+	ID               int     `json:"id" db:"id"`
+	SubscriptionID   int     `json:"subscription_id" db:"subscription_id"`
+	UserID           int     `json:"user_id" db:"user_id"`
+	SignalID         int     `json:"signal_id" db:"signal_id"`
+	PeriodStart      int64   `json:"period_start" db:"period_start"`
+	PeriodEnd        int64   `json:"period_end" db:"period_end"`
+	Amount           float64 `json:"amount" db:"amount"`
+	Status           string  `json:"status" db:"status"`
+	DueTime          int64   `json:"due_time" db:"due_time"`
+	PaidTime         *int64  `json:"paid_time,omitempty" db:"paid_time"`
+	PaymentReference *string `json:"payment_reference,omitempty" db:"payment_reference"`
+}
+
+// BillableSubscription is a subscription with the price of its signal.
+type BillableSubscription struct {
+	Subscription
+	Price float64 `json:"price" db:"price"`
+}
+
+// Revenue summarizes the invoices of a signal for its provider.
+type Revenue struct {
+	SignalID    int     `json:"signal_id" db:"signal_id"`
+	NumInvoices int     `json:"num_invoices" db:"num_invoices"`
+	Paid        float64 `json:"paid" db:"paid"`
+	Unpaid      float64 `json:"unpaid" db:"unpaid"`
+	Overdue     float64 `json:"overdue" db:"overdue"`
+
+	// Pending is the amount of the invoices whose payment is in progress.
+	Pending float64 `json:"pending" db:"pending"`
+}
@@ -0,0 +1,36 @@
+package model
+
+const (
+	// EMAIL is the kind of the notification channels sending emails.
+	EMAIL = "email"
+
+	// WEBHOOK is the kind of the notification channels posting to a URL.
+	WEBHOOK = "webhook"
+
+	// DELIVERED is the status of a delivered notification.
+	DELIVERED = "delivered"
+
+	// FAILED is the status of a notification which could not be delivered.
+	FAILED = "failed"
+)
+
+// NotificationChannel is where a user receives the notifications of the signals they subscribe to.
+type NotificationChannel struct {
+	ID     int    `json:"id" db:"id"`
+	UserID int    `json:"user_id" db:"user_id"`
+	Kind   string `json:"kind" binding:"required" db:"kind"`
+	Target string `json:"target" binding:"required" db:"target"`
+}
+
+// Delivery is the log entry of a notification sent to a channel.
+type Delivery struct {
+	ID        int    `json:"id" db:"id"`
+	ChannelID int    `json:"channel_id" db:"channel_id"`
+	UserID    int    `json:"user_id" db:"user_id"`
+	SignalID  int    `json:"signal_id" db:"signal_id"`
+	EventType string `json:"event_type" db:"event_type"`
+	Status    string `json:"status" db:"status"`
+	Attempts  int    `json:"attempts" db:"attempts"`
+	LastError string `json:"last_error,omitempty" db:"last_error"`
+	Time      int64  `json:"time" db:"delivery_time"`
+}
@@ -22,13 +22,43 @@ const (
 
 type Signal struct {
 	ID             int     `json:"id" db:"id"`
-	Name           string  `json:"name" binding:"required" db:"name"`
-	Description    string  `json:"description,omitempty" db:"description"`
+	OwnerID        *int    `json:"owner_id,omitempty" db:"owner_id"`
+	Name           string  `json:"name" binding:"required,max=100" db:"name"`
+	Description    string  `json:"description,omitempty" binding:"max=1000" db:"description"`
+	Tags           Tags    `json:"tags" db:"tags"`
 	NumSubscribers int     `json:"num_subscribers" db:"num_subscribers"`
 	NumTrades      int     `json:"num_trades" db:"num_trades"`
-	Price          float64 `json:"price" binding:"required" db:"price"`
+	Price          float64 `json:"price" binding:"required,gt=0" db:"price"`
 	FirstTradeTime int64   `json:"first_trade_time" db:"first_trade_time"`
 	LastTradeTime  int64   `json:"last_trade_time" db:"last_trade_time"`
+
+	// Follower is set on the private signals holding the portfolio of a copy-trading follower.
+	Follower bool `json:"follower,omitempty" db:"is_follower"`
+
+	// Version is incremented by every metadata update, to detect concurrent updates.
+	Version int `json:"version" db:"version"`
+
+	// ArchivedTime is set when the signal is archived. Archived signals are read-only.
+	ArchivedTime *int64 `json:"archived_time,omitempty" db:"archived_time"`
+}
+
+// OwnedBy reports whether the signal is owned by the user with the given id.
+func (s Signal) OwnedBy(userID int) bool {
+	return s.OwnerID != nil && *s.OwnerID == userID
+}
+
+// Archived reports whether the signal is archived.
+func (s Signal) Archived() bool {
+	return s.ArchivedTime != nil
+}
+
+// SignalExport is the whole history of a signal, saved before the signal is purged.
+type SignalExport struct {
+	Signal   Signal       `json:"signal"`
+	Orders   []Order      `json:"orders"`
+	Holdings []Holding    `json:"holdings"`
+	Stats    []Stats      `json:"stats"`
+	AuditLog []AuditEntry `json:"audit_log"`
 }
 
 type Holding struct {
@@ -44,15 +74,20 @@ type Holding struct {
 
 type Order struct {
 	ID        int     `json:"id" db:"id"`
-	SignalID  int     `json:"signal_id" binding:"required" db:"signal_id"`
+	SignalID  int     `json:"signal_id" db:"signal_id"`
 	Time      int64   `json:"order_time" db:"order_time"`
 	Type      string  `json:"type,omitempty" binding:"required" db:"type"`
 	Code      string  `json:"code,omitempty" db:"code"`
 	Name      string  `json:"name,omitempty" db:"name"`
-	NumShares int     `json:"num_shares" db:"num_shares"`
-	Price     float64 `json:"price" db:"price"`
+	NumShares int     `json:"num_shares" binding:"min=0" db:"num_shares"`
+	Price     float64 `json:"price" binding:"min=0" db:"price"`
 	Profit    float64 `json:"profit" db:"profit"`
 	PastOrder bool
+
+	// BalanceBefore and SharesBefore are the balance of the signal and its
+	// shares of the order stock right before the order is registered.
+	BalanceBefore float64 `json:"-" db:"-"`
+	SharesBefore  int     `json:"-" db:"-"`
 }
 
 type Stats struct {
@@ -0,0 +1,19 @@
+package model
+
+const (
+	// ACTIVE is the status of a running subscription.
+	ACTIVE = "active"
+
+	// CANCELLED is the status of a subscription which is ended by the subscriber.
+	CANCELLED = "cancelled"
+)
+
+// Subscription links a user to a signal they follow.
+type Subscription struct {
+	ID        int    `json:"id" db:"id"`
+	UserID    int    `json:"user_id" db:"user_id"`
+	SignalID  int    `json:"signal_id" binding:"required" db:"signal_id"`
+	StartTime int64  `json:"start_time" db:"start_time"`
+	EndTime   *int64 `json:"end_time,omitempty" db:"end_time"`
+	Status    string `json:"status" db:"status"`
+}
@@ -0,0 +1,72 @@
+package model
+
+import (
+	"database/sql/driver"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// TAG_SECTOR is the tag category of the market sector a signal trades, as in sector:technology.
+	TAG_SECTOR = "sector"
+
+	// TAG_STYLE is the tag category of the strategy style of a signal, as in style:swing.
+	TAG_STYLE = "style"
+
+	// TAG_RISK is the tag category of the risk level of a signal: risk:low, risk:medium or risk:high.
+	TAG_RISK = "risk"
+)
+
+// TAG_CATEGORIES are the categories a tag can be prefixed with. Tags without a category are free-form.
+var TAG_CATEGORIES = []string{TAG_SECTOR, TAG_STYLE, TAG_RISK}
+
+// RISK_LEVELS are the values of the risk tags.
+var RISK_LEVELS = []string{"low", "medium", "high"}
+
+// Tags are the tags of a signal, stored in a text array column.
+type Tags []string
+
+// Scan reads the tags from the database.
+func (t *Tags) Scan(src interface{}) error {
+	var a pq.StringArray
+	if err := a.Scan(src); err != nil {
+		return err
+	}
+	*t = Tags(a)
+	return nil
+}
+
+// Value writes the tags to the database. Nil tags are stored as an empty array.
+func (t Tags) Value() (driver.Value, error) {
+	if t == nil {
+		return "{}", nil
+	}
+	return pq.StringArray(t).Value()
+}
+
+// NormalizeTag lowercases the given tag and trims the spaces around it and its category.
+func NormalizeTag(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.Index(tag, ":"); i >= 0 {
+		tag = strings.TrimSpace(tag[:i]) + ":" + strings.TrimSpace(tag[i+1:])
+	}
+	return tag
+}
+
+// Normalize returns the normalized tags, sorted and without duplicates.
+func (t Tags) Normalize() Tags {
+	seen := make(map[string]bool)
+	normalized := Tags{}
+	for _, tag := range t {
+		tag = NormalizeTag(tag)
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+
+	sort.Strings(normalized)
+	return normalized
+}
@@ -1,7 +1,39 @@
 package model
 
+const (
+	// ADMIN is the role of the users who can manage every signal and user.
+	ADMIN = "admin"
+
+	// PROVIDER is the role of the users who can create signals and trade them.
+	PROVIDER = "provider"
+
+	// SUBSCRIBER is the role of the users who can only follow signals.
+	SUBSCRIBER = "subscriber"
+)
+
+// User is a registered user. Password holds the password given on
+// registration and the bcrypt hash once it is read from the database, so a
+// User must never be written to a response; use PublicUser instead.
 type User struct {
 	ID       int    `json:"id" db:"id"`
 	Email    string `json:"email" db:"email"`
 	Password string `json:"password" db:"password"`
+	Role     string `json:"role" db:"role"`
+}
+
+// IsAdmin reports whether the user has the admin role.
+func (u User) IsAdmin() bool {
+	return u.Role == ADMIN
+}
+
+// PublicUser is the representation of a user returned by the API.
+type PublicUser struct {
+	ID    int    `json:"id"`
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+// Public returns the user without its password.
+func (u User) Public() PublicUser {
+	return PublicUser{ID: u.ID, Email: u.Email, Role: u.Role}
 }
@@ -0,0 +1,25 @@
+package model
+
+// Webhook is an endpoint receiving the signed order and stats events of a signal.
+type Webhook struct {
+	ID       int    `json:"id" db:"id"`
+	UserID   int    `json:"user_id" db:"user_id"`
+	SignalID int    `json:"signal_id" binding:"required" db:"signal_id"`
+	URL      string `json:"url" binding:"required" db:"url"`
+
+	// Secret is the key signing the payloads. It is only returned when the webhook is registered.
+	Secret      string `json:"secret,omitempty" db:"secret"`
+	CreatedTime int64  `json:"created_time" db:"created_time"`
+}
+
+// DeadLetter is a webhook payload which could not be delivered after all retries.
+type DeadLetter struct {
+	ID           int    `json:"id" db:"id"`
+	WebhookID    int    `json:"webhook_id" db:"webhook_id"`
+	EventType    string `json:"event_type" db:"event_type"`
+	Payload      string `json:"payload" db:"payload"`
+	Attempts     int    `json:"attempts" db:"attempts"`
+	LastError    string `json:"last_error" db:"last_error"`
+	Time         int64  `json:"time" db:"dead_letter_time"`
+	ReplayedTime *int64 `json:"replayed_time,omitempty" db:"replayed_time"`
+}
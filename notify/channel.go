@@ -0,0 +1,116 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/heroku/stocksignals/events"
+	"github.com/heroku/stocksignals/webhook"
+)
+
+// Channel delivers the notification of an event to a target, like an email
+// address or a URL.
+type Channel interface {
+	Send(target string, event events.Event) error
+}
+
+// SMTPChannel sends the notifications as plain text emails.
+type SMTPChannel struct {
+	// Addr is the host:port of the SMTP server.
+	Addr string
+	From string
+	Auth smtp.Auth
+}
+
+// NewSMTPChannel creates an email channel sending through the given SMTP
+// server. Username and password are used with PLAIN authentication if set.
+func NewSMTPChannel(host string, port int, username, password, from string) *SMTPChannel {
+	channel := &SMTPChannel{Addr: fmt.Sprintf("%s:%d", host, port), From: from}
+	if username != "" {
+		channel.Auth = smtp.PlainAuth("", username, password, host)
+	}
+	return channel
+}
+
+// Send emails the notification of the event to the target address.
+func (s *SMTPChannel) Send(target string, event events.Event) error {
+	if strings.ContainsAny(target, "\r\n") {
+		return fmt.Errorf("invalid email address %q", target)
+	}
+
+	subject, body := format(event)
+	message := "From: " + s.From + "\r\n" +
+		"To: " + target + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + body + "\r\n"
+
+	if err := smtp.SendMail(s.Addr, s.Auth, s.From, []string{target}, []byte(message)); err != nil {
+		return fmt.Errorf("failed to send email to %s : %s", target, err)
+	}
+
+	return nil
+}
+
+// WebhookChannel posts the events as JSON to the target URL.
+type WebhookChannel struct {
+	Client *http.Client
+}
+
+// NewWebhookChannel creates a webhook channel whose requests time out after the given duration.
+// Like the signal webhooks, it refuses to post to non public addresses.
+func NewWebhookChannel(timeout time.Duration) *WebhookChannel {
+	return &WebhookChannel{Client: webhook.NewClient(timeout)}
+}
+
+// Send posts the event to the target URL and expects a 2xx response.
+func (w *WebhookChannel) Send(target string, event events.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event : %s", event.Type, err)
+	}
+
+	response, err := w.Client.Post(target, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to post to webhook %s : %s", target, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s responded with status %d", target, response.StatusCode)
+	}
+
+	return nil
+}
+
+func format(event events.Event) (string, string) {
+	switch event.Type {
+	case events.ORDER:
+		return fmt.Sprintf("New order on signal %d", event.SignalID),
+			fmt.Sprintf("A new order is registered on signal %d : %s", event.SignalID, describe(event.Data))
+	case events.PORTFOLIO:
+		return fmt.Sprintf("Portfolio of signal %d changed", event.SignalID),
+			fmt.Sprintf("The portfolio of signal %d is now : %s", event.SignalID, describe(event.Data))
+	case events.STATS:
+		return fmt.Sprintf("New stats of signal %d", event.SignalID),
+			fmt.Sprintf("The stats of signal %d are updated : %s", event.SignalID, describe(event.Data))
+	case events.COPY_SKIPPED:
+		return fmt.Sprintf("Order of signal %d not copied", event.SignalID),
+			fmt.Sprintf("An order of signal %d could not be copied to your portfolio : %s", event.SignalID, describe(event.Data))
+	default:
+		return fmt.Sprintf("Signal %d is updated", event.SignalID), describe(event.Data)
+	}
+}
+
+func describe(data interface{}) string {
+	encoded, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("%v", data)
+	}
+	return string(encoded)
+}
@@ -0,0 +1,144 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/heroku/stocksignals/events"
+	"github.com/heroku/stocksignals/model"
+	"github.com/heroku/stocksignals/store"
+	"github.com/heroku/stocksignals/webhook"
+)
+
+// Dispatcher delivers the events of the signals to the notification channels
+// of their subscribers, retrying failed deliveries, and logs every delivery.
+type Dispatcher struct {
+	channels    map[string]Channel
+	maxAttempts int
+	backoff     time.Duration
+	sem         chan struct{}
+	wg          sync.WaitGroup
+}
+
+// NewDispatcher creates a dispatcher sending through the given channels keyed
+// by kind. A delivery is attempted up to maxAttempts times, waiting backoff,
+// then twice as long, between the attempts. At most workers deliveries run
+// at the same time.
+func NewDispatcher(channels map[string]Channel, maxAttempts int, backoff time.Duration, workers int) *Dispatcher {
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+
+	if workers <= 0 {
+		workers = 1
+	}
+
+	return &Dispatcher{
+		channels:    channels,
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+		sem:         make(chan struct{}, workers),
+	}
+}
+
+// Run dispatches the events received from the given subscription until the
+// context is done, then waits for the running deliveries.
+func (d *Dispatcher) Run(ctx context.Context, subscription *events.Subscription) {
+	defer d.wg.Wait()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-subscription.C:
+			if !ok {
+				return
+			}
+			d.dispatch(ctx, event)
+		}
+	}
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context, event events.Event) {
+	channels, err := store.GetSubscriberChannels(event.SignalID)
+	if err != nil {
+		log.Printf("failed to get notification channels of signal %d : %s", event.SignalID, err)
+		return
+	}
+
+	if trade, ok := event.Data.(model.CopyTrade); ok {
+		if channels, err = followerChannels(channels, trade.FollowerID); err != nil {
+			log.Printf("failed to get notification channels of follower %d : %s", trade.FollowerID, err)
+			return
+		}
+	}
+
+	for _, channel := range channels {
+		select {
+		case <-ctx.Done():
+			return
+		case d.sem <- struct{}{}:
+		}
+
+		d.wg.Add(1)
+		go func(channel model.NotificationChannel) {
+			defer d.wg.Done()
+			defer func() { <-d.sem }()
+
+			d.deliver(ctx, channel, event)
+		}(channel)
+	}
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, channel model.NotificationChannel, event events.Event) {
+	delivery := model.Delivery{
+		ChannelID: channel.ID,
+		UserID:    channel.UserID,
+		SignalID:  event.SignalID,
+		EventType: event.Type,
+		Status:    model.FAILED,
+	}
+
+	sender, ok := d.channels[channel.Kind]
+	if !ok {
+		delivery.LastError = fmt.Sprintf("%s notifications are not configured", channel.Kind)
+	} else {
+		var lastErr error
+		attempts, err := webhook.Retry(ctx, d.maxAttempts, d.backoff, func() error {
+			lastErr = sender.Send(channel.Target, event)
+			return lastErr
+		})
+
+		delivery.Attempts = attempts
+		if err == nil {
+			delivery.Status = model.DELIVERED
+		} else {
+			delivery.LastError = lastErr.Error()
+		}
+	}
+
+	delivery.Time = time.Now().Unix()
+	if err := store.SaveDelivery(delivery); err != nil {
+		log.Printf("failed to log notification delivery : %s", err)
+	}
+}
+
+// followerChannels returns the given channels of the user of the given follower, who is
+// the only subscriber to be told about its copy trades.
+func followerChannels(channels []model.NotificationChannel, followerID int) ([]model.NotificationChannel, error) {
+	follower, err := store.GetFollowerByID(followerID)
+	if err != nil {
+		return nil, err
+	}
+
+	var owned []model.NotificationChannel
+	for _, channel := range channels {
+		if channel.UserID == follower.UserID {
+			owned = append(owned, channel)
+		}
+	}
+	return owned, nil
+}
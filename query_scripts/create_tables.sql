@@ -7,3 +7,71 @@ CREATE TABLE IF NOT EXISTS holdings (id SERIAL UNIQUE, signal_id INT REFERENCES
 CREATE TABLE IF NOT EXISTS orders (id SERIAL UNIQUE, signal_id INT REFERENCES signals(id),  order_time bigint, type TEXT NOT NULL CHECK (type <> ''), code TEXT, name TEXT, num_shares INT CONSTRAINT non_negative_num_shares CHECK (num_shares >= 0), price DECIMAL(10,2) CONSTRAINT non_negative_price CHECK (price >= 0), profit DECIMAL(10,2));
 
 CREATE TABLE IF NOT EXISTS stats (id SERIAL UNIQUE, signal_id INT REFERENCES signals(id), deposits DECIMAL(10,2), withdrawals DECIMAL(10,2), funds DECIMAL(10,2), balance DECIMAL(10,2), equity DECIMAL(10,2), profit DECIMAL(10,2), gain DECIMAL(10,2), drawdown DECIMAL(10,2), stats_time bigint);
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (token_id TEXT PRIMARY KEY, expires_at bigint NOT NULL);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'subscriber' CHECK (role IN ('admin', 'provider', 'subscriber'));
+
+ALTER TABLE signals ADD COLUMN IF NOT EXISTS owner_id INT REFERENCES users(id);
+
+CREATE TABLE IF NOT EXISTS subscriptions (id SERIAL UNIQUE, user_id INT NOT NULL REFERENCES users(id), signal_id INT NOT NULL REFERENCES signals(id), start_time bigint NOT NULL, end_time bigint, status TEXT NOT NULL CHECK (status IN ('active', 'cancelled')));
+
+CREATE UNIQUE INDEX IF NOT EXISTS subscriptions_active_idx ON subscriptions (user_id, signal_id) WHERE status = 'active';
+
+CREATE TABLE IF NOT EXISTS invoices (id SERIAL UNIQUE, subscription_id INT NOT NULL REFERENCES subscriptions(id), user_id INT NOT NULL REFERENCES users(id), signal_id INT NOT NULL REFERENCES signals(id), period_start bigint NOT NULL, period_end bigint NOT NULL, amount DECIMAL(10,2) CONSTRAINT non_negative_amount CHECK (amount >= 0), status TEXT NOT NULL CHECK (status IN ('unpaid', 'paid', 'overdue')), due_time bigint NOT NULL, paid_time bigint, payment_reference TEXT, UNIQUE (subscription_id, period_start));
+
+CREATE TABLE IF NOT EXISTS notification_channels (id SERIAL UNIQUE, user_id INT NOT NULL REFERENCES users(id), kind TEXT NOT NULL CHECK (kind IN ('email', 'webhook')), target TEXT NOT NULL CHECK (target <> ''));
+
+CREATE TABLE IF NOT EXISTS notification_deliveries (id SERIAL UNIQUE, channel_id INT NOT NULL REFERENCES notification_channels(id) ON DELETE CASCADE, user_id INT NOT NULL REFERENCES users(id), signal_id INT NOT NULL, event_type TEXT NOT NULL, status TEXT NOT NULL CHECK (status IN ('delivered', 'failed')), attempts INT NOT NULL, last_error TEXT NOT NULL DEFAULT '', delivery_time bigint NOT NULL);
+
+CREATE TABLE IF NOT EXISTS webhooks (id SERIAL UNIQUE, user_id INT NOT NULL REFERENCES users(id), signal_id INT NOT NULL REFERENCES signals(id), url TEXT NOT NULL CHECK (url <> ''), secret TEXT NOT NULL, created_time bigint NOT NULL);
+
+CREATE TABLE IF NOT EXISTS webhook_dead_letters (id SERIAL UNIQUE, webhook_id INT NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE, event_type TEXT NOT NULL, payload TEXT NOT NULL, attempts INT NOT NULL, last_error TEXT NOT NULL, dead_letter_time bigint NOT NULL, replayed_time bigint);
+
+ALTER TABLE signals ADD COLUMN IF NOT EXISTS is_follower BOOLEAN NOT NULL DEFAULT false;
+
+ALTER TABLE signals DROP CONSTRAINT IF EXISTS positive_price, ADD CONSTRAINT positive_price CHECK (price > 0 OR is_follower);
+
+CREATE TABLE IF NOT EXISTS followers (id SERIAL UNIQUE, user_id INT NOT NULL REFERENCES users(id), leader_id INT NOT NULL REFERENCES signals(id), signal_id INT NOT NULL UNIQUE REFERENCES signals(id), capital DECIMAL(10,2) CONSTRAINT positive_capital CHECK (capital > 0), slippage REAL NOT NULL CONSTRAINT non_negative_slippage CHECK (slippage >= 0), status TEXT NOT NULL CHECK (status IN ('active', 'stopped')), created_time bigint NOT NULL);
+
+CREATE UNIQUE INDEX IF NOT EXISTS followers_active_idx ON followers (user_id, leader_id) WHERE status = 'active';
+
+CREATE TABLE IF NOT EXISTS copy_trades (id SERIAL UNIQUE, follower_id INT NOT NULL REFERENCES followers(id) ON DELETE CASCADE, leader_order_id INT NOT NULL, order_id INT, status TEXT NOT NULL CHECK (status IN ('copied', 'skipped')), reason TEXT NOT NULL DEFAULT '', copy_time bigint NOT NULL);
+
+CREATE INDEX IF NOT EXISTS signals_price_idx ON signals (price, id) WHERE NOT is_follower;
+
+CREATE INDEX IF NOT EXISTS orders_signal_time_idx ON orders (signal_id, order_time, id);
+
+CREATE INDEX IF NOT EXISTS orders_signal_code_idx ON orders (signal_id, code, order_time);
+
+CREATE INDEX IF NOT EXISTS stats_signal_time_idx ON stats (signal_id, stats_time, id);
+
+ALTER TABLE signals ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+
+CREATE TABLE IF NOT EXISTS audit_log (id SERIAL UNIQUE, user_id INT REFERENCES users(id), signal_id INT NOT NULL, action TEXT NOT NULL CHECK (action <> ''), entity_id INT NOT NULL, changes TEXT NOT NULL, audit_time bigint NOT NULL);
+
+CREATE INDEX IF NOT EXISTS audit_log_signal_idx ON audit_log (signal_id, audit_time, id);
+
+ALTER TABLE signals ADD COLUMN IF NOT EXISTS archived_time bigint;
+
+CREATE TABLE IF NOT EXISTS signal_exports (id SERIAL UNIQUE, signal_id INT NOT NULL, user_id INT REFERENCES users(id), data TEXT NOT NULL, export_time bigint NOT NULL);
+
+ALTER TABLE signals ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS signals_tags_idx ON signals USING GIN (tags);
+
+CREATE OR REPLACE FUNCTION signal_search_document(name TEXT, description TEXT, tags TEXT[]) RETURNS tsvector AS $$ SELECT to_tsvector('english', coalesce(name, '') || ' ' || coalesce(description, '') || ' ' || coalesce(array_to_string(tags, ' '), '')) $$ LANGUAGE SQL IMMUTABLE;
+
+CREATE INDEX IF NOT EXISTS signals_search_idx ON signals USING GIN (signal_search_document(name, description, tags));
+
+CREATE INDEX IF NOT EXISTS holdings_code_idx ON holdings (upper(code), signal_id);
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (user_id INT NOT NULL REFERENCES users(id), idempotency_key TEXT NOT NULL, request_hash TEXT NOT NULL, status INT NOT NULL DEFAULT 0, content_type TEXT NOT NULL DEFAULT '', response TEXT NOT NULL DEFAULT '', created_time bigint NOT NULL, expires_time bigint NOT NULL, PRIMARY KEY (user_id, idempotency_key));
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_idx ON idempotency_keys (expires_time);
+
+ALTER TABLE invoices DROP CONSTRAINT IF EXISTS invoices_status_check, ADD CONSTRAINT invoices_status_check CHECK (status IN ('unpaid', 'paid', 'overdue', 'pending'));
+
+CREATE TABLE IF NOT EXISTS pending_copies (order_id INT PRIMARY KEY REFERENCES orders(id) ON DELETE CASCADE, queue_time bigint NOT NULL);
+
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS locked_until bigint NOT NULL DEFAULT 0;
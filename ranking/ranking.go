@@ -0,0 +1,295 @@
+package ranking
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/heroku/stocksignals/config"
+	"github.com/heroku/stocksignals/model"
+	"github.com/heroku/stocksignals/store"
+)
+
+const (
+	// WINDOW_30D ranks the signals on the last 30 days.
+	WINDOW_30D = "30d"
+
+	// WINDOW_90D ranks the signals on the last 90 days.
+	WINDOW_90D = "90d"
+
+	// WINDOW_1Y ranks the signals on the last year.
+	WINDOW_1Y = "1y"
+
+	// WINDOW_ALL ranks the signals on their whole history.
+	WINDOW_ALL = "all"
+)
+
+// WINDOWS are the windows of the rankings, in refresh order.
+var WINDOWS = []string{WINDOW_30D, WINDOW_90D, WINDOW_1Y, WINDOW_ALL}
+
+// Metrics are the performance figures of a signal over a window. Return and
+// MaxDrawdown are percentages, RiskAdjustedReturn is the mean return between
+// two stats over its standard deviation.
+type Metrics struct {
+	Return             float64 `json:"return"`
+	RiskAdjustedReturn float64 `json:"risk_adjusted_return"`
+	MaxDrawdown        float64 `json:"max_drawdown"`
+	TrackRecordDays    float64 `json:"track_record_days"`
+	Trades             int     `json:"trades"`
+	Subscribers        int     `json:"subscribers"`
+}
+
+// Entry is the position of a signal in a ranking. Score is between 0 and 100.
+type Entry struct {
+	Rank     int     `json:"rank"`
+	SignalID int     `json:"signal_id"`
+	Name     string  `json:"name"`
+	Score    float64 `json:"score"`
+	Metrics
+}
+
+// Ranking is the leaderboard of the eligible signals over a window, best first.
+type Ranking struct {
+	Window       string  `json:"window"`
+	ComputedTime int64   `json:"computed_time"`
+	Entries      []Entry `json:"entries"`
+}
+
+var (
+	mu       sync.RWMutex
+	rankings = make(map[string]*Ranking)
+)
+
+// Get returns the cached ranking of the given window, computing it if it was never refreshed.
+func Get(window string, cfg config.RankingConfig) (*Ranking, error) {
+	if _, err := windowStart(window, time.Now()); err != nil {
+		return nil, err
+	}
+
+	mu.RLock()
+	ranking, ok := rankings[window]
+	mu.RUnlock()
+	if ok {
+		return ranking, nil
+	}
+
+	ranking, err := Compute(window, time.Now(), cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	mu.Lock()
+	rankings[window] = ranking
+	mu.Unlock()
+	return ranking, nil
+}
+
+// Refresh recomputes and caches the rankings of all windows. A window failing
+// to compute keeps its previous ranking.
+func Refresh(now time.Time, cfg config.RankingConfig) error {
+	var failed []string
+	for _, window := range WINDOWS {
+		ranking, err := Compute(window, now, cfg)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s : %s", window, err))
+			continue
+		}
+
+		mu.Lock()
+		rankings[window] = ranking
+		mu.Unlock()
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to compute rankings %v", failed)
+	}
+	return nil
+}
+
+// Compute ranks the eligible signals over the given window ending at the given time.
+// The private signals of the copy-trading followers are never ranked. Another signal is
+// eligible when its first trade is at least MinHistory old, it has at least MinTrades
+// trades and it has at least two stats in the window.
+func Compute(window string, now time.Time, cfg config.RankingConfig) (*Ranking, error) {
+	start, err := windowStart(window, now)
+	if err != nil {
+		return nil, err
+	}
+
+	signals, err := store.GetAllSignals()
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []model.Signal
+	var ids []int
+	for _, signal := range signals {
+		if signal.Follower || signal.FirstTradeTime == 0 || signal.NumTrades < cfg.MinTrades {
+			continue
+		}
+
+		if now.Sub(time.Unix(signal.FirstTradeTime, 0)) < cfg.MinHistory {
+			continue
+		}
+
+		candidates = append(candidates, signal)
+		ids = append(ids, signal.ID)
+	}
+
+	stats, err := store.GetStatsSince(ids, start)
+	if err != nil {
+		return nil, err
+	}
+
+	trades, err := store.CountTradesSince(ids, start)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, signal := range candidates {
+		if len(stats[signal.ID]) < 2 {
+			continue
+		}
+
+		metrics := computeMetrics(stats[signal.ID])
+		metrics.TrackRecordDays = now.Sub(time.Unix(signal.FirstTradeTime, 0)).Hours() / 24
+		metrics.Trades = trades[signal.ID]
+		metrics.Subscribers = signal.NumSubscribers
+
+		entries = append(entries, Entry{SignalID: signal.ID, Name: signal.Name, Metrics: metrics})
+	}
+
+	score(entries, cfg.Weights)
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Score != entries[j].Score {
+			return entries[i].Score > entries[j].Score
+		}
+		return entries[i].SignalID < entries[j].SignalID
+	})
+
+	for i := range entries {
+		entries[i].Rank = i + 1
+	}
+
+	if entries == nil {
+		entries = []Entry{}
+	}
+	return &Ranking{Window: window, ComputedTime: now.Unix(), Entries: entries}, nil
+}
+
+// windowStart returns the unix time the given window starts at, 0 for the whole history
+func windowStart(window string, now time.Time) (int64, error) {
+	switch window {
+	case WINDOW_30D:
+		return now.AddDate(0, 0, -30).Unix(), nil
+	case WINDOW_90D:
+		return now.AddDate(0, 0, -90).Unix(), nil
+	case WINDOW_1Y:
+		return now.AddDate(-1, 0, 0).Unix(), nil
+	case WINDOW_ALL:
+		return 0, nil
+	}
+	return 0, store.Invalid("window", "window must be one of %v", WINDOWS)
+}
+
+// computeMetrics computes the return, risk-adjusted return and max drawdown of the given
+// stats, oldest first. The return between two stats is the change of the net profit
+// (equity plus withdrawals minus deposits) over the previous equity, so that deposits
+// and withdrawals do not count as performance.
+func computeMetrics(stats []model.Stats) Metrics {
+	var returns []float64
+	index, peak, maxDrawdown := 1.0, 1.0, 0.0
+	for i := 1; i < len(stats); i++ {
+		previous, current := stats[i-1], stats[i]
+		if previous.Equity <= 0 {
+			continue
+		}
+
+		r := (netProfit(current) - netProfit(previous)) / previous.Equity
+		returns = append(returns, r)
+
+		index *= 1 + r
+		if index > peak {
+			peak = index
+		}
+		if drawdown := (peak - index) / peak; drawdown > maxDrawdown {
+			maxDrawdown = drawdown
+		}
+	}
+
+	metrics := Metrics{Return: (index - 1) * 100, MaxDrawdown: maxDrawdown * 100}
+	if len(returns) == 0 {
+		return metrics
+	}
+
+	var mean float64
+	for _, r := range returns {
+		mean += r
+	}
+	mean /= float64(len(returns))
+
+	var variance float64
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+	}
+	variance /= float64(len(returns))
+
+	if std := math.Sqrt(variance); std > 0 {
+		metrics.RiskAdjustedReturn = mean / std
+	}
+	return metrics
+}
+
+func netProfit(stats model.Stats) float64 {
+	return stats.Equity + stats.Withdrawals - stats.Deposits
+}
+
+// score sets the composite score of the given entries: the weighted average of their
+// metrics, each normalized between 0 and 1 across the entries. Drawdown is inverted,
+// and the track record, trades and subscribers are compared on a log scale so that a
+// few outliers do not flatten the others.
+func score(entries []Entry, weights config.RankingWeights) {
+	metrics := []struct {
+		weight float64
+		value  func(Metrics) float64
+	}{
+		{weights.RiskAdjustedReturn, func(m Metrics) float64 { return m.RiskAdjustedReturn }},
+		{weights.Drawdown, func(m Metrics) float64 { return -m.MaxDrawdown }},
+		{weights.TrackRecord, func(m Metrics) float64 { return math.Log1p(m.TrackRecordDays) }},
+		{weights.Trades, func(m Metrics) float64 { return math.Log1p(float64(m.Trades)) }},
+		{weights.Subscribers, func(m Metrics) float64 { return math.Log1p(float64(m.Subscribers)) }},
+	}
+
+	var total float64
+	for _, metric := range metrics {
+		total += metric.weight
+	}
+
+	if len(entries) == 0 || total == 0 {
+		return
+	}
+
+	for _, metric := range metrics {
+		min, max := math.Inf(1), math.Inf(-1)
+		for _, entry := range entries {
+			v := metric.value(entry.Metrics)
+			min, max = math.Min(min, v), math.Max(max, v)
+		}
+
+		for i := range entries {
+			// All the entries are equal on this metric, so they all get the full weight
+			normalized := 1.0
+			if max > min {
+				normalized = (metric.value(entries[i].Metrics) - min) / (max - min)
+			}
+			entries[i].Score += metric.weight * normalized / total
+		}
+	}
+
+	for i := range entries {
+		entries[i].Score = math.Round(entries[i].Score*10000) / 100
+	}
+}
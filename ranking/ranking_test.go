@@ -0,0 +1,158 @@
+package ranking
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/heroku/stocksignals/config"
+	"github.com/heroku/stocksignals/model"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestComputeMetrics(t *testing.T) {
+	tests := []struct {
+		name  string
+		stats []model.Stats
+		want  Metrics
+	}{
+		{
+			"deposits are not returns",
+			[]model.Stats{{Equity: 1000}, {Equity: 1500, Deposits: 500}, {Equity: 1500, Deposits: 500}},
+			Metrics{},
+		},
+		{
+			"withdrawals are not losses",
+			[]model.Stats{{Equity: 1000}, {Equity: 600, Withdrawals: 400}},
+			Metrics{},
+		},
+		{
+			"returns net of a deposit",
+			[]model.Stats{{Equity: 1000}, {Equity: 1600, Deposits: 500}},
+			Metrics{Return: 10},
+		},
+		{
+			"drawdown from the peak",
+			[]model.Stats{{Equity: 1000}, {Equity: 1250}, {Equity: 1000}},
+			Metrics{Return: 0, MaxDrawdown: 20, RiskAdjustedReturn: 1.0 / 9},
+		},
+		{
+			"zero standard deviation has no risk-adjusted return",
+			[]model.Stats{{Equity: 1000}, {Equity: 1100}, {Equity: 1210}},
+			Metrics{Return: 21},
+		},
+		{
+			"risk-adjusted return is the mean over the standard deviation",
+			[]model.Stats{{Equity: 1000}, {Equity: 1100}, {Equity: 1045}},
+			Metrics{Return: 4.5, MaxDrawdown: 5, RiskAdjustedReturn: 1.0 / 3},
+		},
+		{
+			"stats without equity are skipped",
+			[]model.Stats{{Equity: 0}, {Equity: 1000, Deposits: 1000}, {Equity: 1100, Deposits: 1000}},
+			Metrics{Return: 10},
+		},
+		{
+			"a single stats has no metrics",
+			[]model.Stats{{Equity: 1000}},
+			Metrics{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := computeMetrics(test.stats)
+			if !near(got.Return, test.want.Return) || !near(got.MaxDrawdown, test.want.MaxDrawdown) ||
+				!near(got.RiskAdjustedReturn, test.want.RiskAdjustedReturn) {
+				t.Errorf("computeMetrics() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights config.RankingWeights
+		metrics []Metrics
+		want    []float64
+	}{
+		{
+			"equal metrics all get the full score",
+			config.RankingWeights{RiskAdjustedReturn: 1, Drawdown: 1, TrackRecord: 1, Trades: 1, Subscribers: 1},
+			[]Metrics{{RiskAdjustedReturn: 1, Trades: 10}, {RiskAdjustedReturn: 1, Trades: 10}},
+			[]float64{100, 100},
+		},
+		{
+			"metrics are normalized between the entries",
+			config.RankingWeights{RiskAdjustedReturn: 1},
+			[]Metrics{{RiskAdjustedReturn: 2}, {RiskAdjustedReturn: 0.5}, {RiskAdjustedReturn: -1}},
+			[]float64{100, 50, 0},
+		},
+		{
+			"a lower drawdown scores higher",
+			config.RankingWeights{Drawdown: 1},
+			[]Metrics{{MaxDrawdown: 40}, {MaxDrawdown: 10}},
+			[]float64{0, 100},
+		},
+		{
+			"scores are weighted averages",
+			config.RankingWeights{RiskAdjustedReturn: 3, Trades: 1},
+			[]Metrics{{RiskAdjustedReturn: 1, Trades: 0}, {RiskAdjustedReturn: 0, Trades: 5}},
+			[]float64{75, 25},
+		},
+		{
+			"counts are compared on a log scale",
+			config.RankingWeights{Subscribers: 1},
+			[]Metrics{{Subscribers: 0}, {Subscribers: 9}, {Subscribers: 99}},
+			[]float64{0, 50, 100},
+		},
+		{
+			"zero weights leave the scores",
+			config.RankingWeights{},
+			[]Metrics{{RiskAdjustedReturn: 2}, {RiskAdjustedReturn: 1}},
+			[]float64{0, 0},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entries := make([]Entry, len(test.metrics))
+			for i, metrics := range test.metrics {
+				entries[i].Metrics = metrics
+			}
+
+			score(entries, test.weights)
+			for i, entry := range entries {
+				if math.Abs(entry.Score-test.want[i]) > 0.01 {
+					t.Errorf("score of entry %d = %v, want %v", i, entry.Score, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWindowStart(t *testing.T) {
+	now := time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		window string
+		want   int64
+	}{
+		{WINDOW_30D, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Unix()},
+		{WINDOW_90D, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC).Unix()},
+		{WINDOW_1Y, time.Date(2023, 3, 31, 12, 0, 0, 0, time.UTC).Unix()},
+		{WINDOW_ALL, 0},
+	}
+
+	for _, test := range tests {
+		if got, err := windowStart(test.window, now); err != nil || got != test.want {
+			t.Errorf("windowStart(%s) = %d, %v, want %d", test.window, got, err, test.want)
+		}
+	}
+
+	if _, err := windowStart("7d", now); err == nil {
+		t.Errorf("windowStart(7d) returned no error")
+	}
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/heroku/stocksignals/auth"
+	"github.com/heroku/stocksignals/model"
+	"github.com/heroku/stocksignals/store"
+)
+
+const claimsKey = "claims"
+
+type credentials struct {
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// Login verifies the given credentials and issues an access token
+func Login(c *gin.Context) {
+	var creds credentials
+	if err := bindJSON(c, &creds); err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := store.VerifyUser(creds.Email, creds.Password)
+	if err == store.ErrInvalidCredentials {
+		unauthorized(c, err.Error())
+		return
+	}
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	issueToken(c, user.ID, user.Email)
+}
+
+// RefreshToken issues a new access token for the authenticated user and revokes the current one
+func RefreshToken(c *gin.Context) {
+	claims := currentClaims(c)
+	if err := store.RevokeToken(claims.ID, claims.ExpiresAt); err != nil {
+		c.Error(err)
+		return
+	}
+
+	issueToken(c, claims.UserID, claims.Email)
+}
+
+// Logout revokes the access token of the request
+func Logout(c *gin.Context) {
+	claims := currentClaims(c)
+	if err := store.RevokeToken(claims.ID, claims.ExpiresAt); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "token is revoked"})
+}
+
+func issueToken(c *gin.Context, userID int, email string) {
+	token, claims, err := auth.NewToken([]byte(conf.Auth.TokenSecret), userID, email, conf.Auth.TokenTTL)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"token": token, "expires_at": claims.ExpiresAt})
+}
+
+// RequireAuth is a middleware rejecting the requests without a valid bearer token.
+// The claims of the token are stored in the context for the next handlers.
+func RequireAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.Request.Header.Get("Authorization")
+		if !strings.HasPrefix(header, "Bearer ") {
+			unauthorized(c, "missing bearer token")
+			return
+		}
+
+		if authenticate(c, strings.TrimPrefix(header, "Bearer "), "") {
+			c.Next()
+		}
+	}
+}
+
+// RequireStreamAuth is a middleware like RequireAuth for the stream of the signal ID parameter,
+// which also accepts a stream token in the token query parameter, as browsers cannot set the
+// headers of their event sources.
+func RequireStreamAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.Request.Header.Get("Authorization")
+		token := c.Query("token")
+		switch {
+		case strings.HasPrefix(header, "Bearer "):
+			if !authenticate(c, strings.TrimPrefix(header, "Bearer "), "") {
+				return
+			}
+		case token != "":
+			if !authenticate(c, token, streamScope(c.Param("id"))) {
+				return
+			}
+		default:
+			unauthorized(c, "missing bearer token")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// authenticate verifies that the given token is valid, is not revoked and has the given scope,
+// then stores its claims in the context. Otherwise it writes the error response and returns false.
+func authenticate(c *gin.Context, token, scope string) bool {
+	claims, err := auth.ParseToken([]byte(conf.Auth.TokenSecret), token)
+	if err != nil {
+		unauthorized(c, err.Error())
+		return false
+	}
+
+	if claims.Scope != scope {
+		unauthorized(c, "token is not valid for this request")
+		return false
+	}
+
+	revoked, err := store.IsTokenRevoked(claims.ID)
+	if err != nil {
+		c.Error(err)
+		c.Abort()
+		return false
+	}
+
+	if revoked {
+		unauthorized(c, "token is revoked")
+		return false
+	}
+
+	c.Set(claimsKey, claims)
+	return true
+}
+
+func unauthorized(c *gin.Context, message string) {
+	c.Header("WWW-Authenticate", `Bearer realm="stocksignals"`)
+	abortWithError(c, UNAUTHORIZED, "%s", message)
+}
+
+// currentClaims returns the claims of the authenticated request. It must only
+// be called from handlers behind RequireAuth.
+func currentClaims(c *gin.Context) *auth.Claims {
+	return c.MustGet(claimsKey).(*auth.Claims)
+}
+
+// currentUser loads the authenticated user of the request. It must only be
+// called from handlers behind RequireAuth.
+func currentUser(c *gin.Context) (*model.User, error) {
+	return store.GetUserByID(currentClaims(c).UserID)
+}
+
+// authorizeRoles checks that the authenticated user has one of the given
+// roles. Otherwise it writes the error response and returns false.
+func authorizeRoles(c *gin.Context, roles ...string) bool {
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return false
+	}
+
+	for _, role := range roles {
+		if user.Role == role {
+			return true
+		}
+	}
+
+	abortWithError(c, FORBIDDEN, "%s users are not allowed to do this", user.Role)
+	return false
+}
+
+// authorizeSignals checks that the authenticated user owns all the signals
+// with the given ids or is an admin. Otherwise it writes the error response
+// and returns false.
+func authorizeSignals(c *gin.Context, ids []int) bool {
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return false
+	}
+
+	if user.IsAdmin() {
+		return true
+	}
+
+	for _, id := range ids {
+		signal, err := store.GetSignalByID(id)
+		if err != nil {
+			c.Error(err)
+			return false
+		}
+
+		if !signal.OwnedBy(user.ID) {
+			abortWithError(c, FORBIDDEN, "signal %d is not owned by the user", id)
+			return false
+		}
+	}
+
+	return true
+}
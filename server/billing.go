@@ -0,0 +1,81 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/heroku/stocksignals/billing"
+	"github.com/heroku/stocksignals/model"
+	"github.com/heroku/stocksignals/store"
+)
+
+// GetInvoices retrieves the invoices of the authenticated user
+func GetInvoices(c *gin.Context) {
+	invoices, err := store.GetInvoicesByUserID(currentClaims(c).UserID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, invoices)
+}
+
+// PayInvoice charges the invoice ID parameter of the authenticated user through the payment gateway
+func PayInvoice(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(invalidParam("id", err))
+		return
+	}
+
+	invoice, err := billing.PayInvoice(gateway, id, currentClaims(c).UserID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, invoice)
+}
+
+// GetRevenue retrieves the revenue of the signals of the authenticated provider
+// for the billing periods starting between the from and to parameters.
+// Admins can get the revenue of any provider with the owner_id parameter.
+func GetRevenue(c *gin.Context) {
+	if !authorizeRoles(c, model.ADMIN, model.PROVIDER) {
+		return
+	}
+
+	from, err := strconv.ParseInt(c.DefaultQuery("from", "0"), 10, 64)
+	if err != nil {
+		c.Error(invalidParam("from", err))
+		return
+	}
+
+	to, err := strconv.ParseInt(c.DefaultQuery("to", strconv.FormatInt(math.MaxInt64, 10)), 10, 64)
+	if err != nil {
+		c.Error(invalidParam("to", err))
+		return
+	}
+
+	ownerID := currentClaims(c).UserID
+	if ownerIDStr := c.Query("owner_id"); ownerIDStr != "" {
+		if !authorizeRoles(c, model.ADMIN) {
+			return
+		}
+
+		if ownerID, err = strconv.Atoi(ownerIDStr); err != nil {
+			c.Error(invalidParam("owner_id", err))
+			return
+		}
+	}
+
+	revenue, err := store.GetRevenue(ownerID, from, to)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, revenue)
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/heroku/stocksignals/store"
+	"github.com/heroku/stocksignals/validation"
+)
+
+const (
+	// UNAUTHORIZED is the code of the errors for unauthenticated requests.
+	UNAUTHORIZED = "unauthorized"
+
+	// FORBIDDEN is the code of the errors for requests the user is not allowed to make.
+	FORBIDDEN = "forbidden"
+
+	// INTERNAL is the code of the unexpected errors.
+	INTERNAL = "internal"
+
+	// IDEMPOTENCY_MISMATCH is the code of the errors for idempotency keys reused by another request.
+	IDEMPOTENCY_MISMATCH = "idempotency_mismatch"
+)
+
+// HandleErrors writes the last error attached to the request by the handlers
+// as a JSON error response, unless a response is already written.
+func HandleErrors() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		writeError(c)
+	}
+}
+
+// writeError writes the last error attached to the request as a JSON error response,
+// if there is one and no response is written yet
+func writeError(c *gin.Context) {
+	if len(c.Errors) == 0 || c.Writer.Written() {
+		return
+	}
+
+	err := c.Errors.Last().Err
+	if e, ok := err.(*store.Error); ok {
+		c.JSON(errorStatus(e.Code), e)
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, store.Error{Code: INTERNAL, Message: err.Error()})
+}
+
+// errorStatus returns the HTTP status of the given error code
+func errorStatus(code string) int {
+	switch code {
+	case store.VALIDATION:
+		return http.StatusBadRequest
+	case UNAUTHORIZED:
+		return http.StatusUnauthorized
+	case FORBIDDEN:
+		return http.StatusForbidden
+	case store.NOT_FOUND:
+		return http.StatusNotFound
+	case store.CONFLICT:
+		return http.StatusConflict
+	case store.VERSION_MISMATCH:
+		return http.StatusPreconditionFailed
+	case store.INSUFFICIENT_FUNDS, IDEMPOTENCY_MISMATCH:
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// abortWithError writes an error response with the given code and aborts the request
+func abortWithError(c *gin.Context, code, format string, args ...interface{}) {
+	c.JSON(errorStatus(code), store.Error{Code: code, Message: fmt.Sprintf(format, args...)})
+	c.Abort()
+}
+
+// invalidParam returns the validation error of a malformed request parameter
+func invalidParam(name string, err error) error {
+	return store.Invalid(name, "invalid %s parameter : %s", name, err)
+}
+
+// bindJSON decodes the request body to the given object and validates its binding
+// tags. Validation failures are reported per field.
+func bindJSON(c *gin.Context, obj interface{}) error {
+	if err := json.NewDecoder(c.Request.Body).Decode(obj); err != nil {
+		return store.Invalid("", "invalid request body : %s", err)
+	}
+
+	return validation.Struct(obj)
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/heroku/stocksignals/export"
+	"github.com/heroku/stocksignals/store"
+)
+
+// ExportSignal streams the zip bundle of the orders, holdings and stats history of the signal
+// ID parameter, with their files in the format query parameter, csv by default.
+// Only the owner of the signal or an admin can export it.
+func ExportSignal(c *gin.Context) {
+	format := c.DefaultQuery("format", export.CSV)
+	if err := export.Check("", format); err != nil {
+		c.Error(err)
+		return
+	}
+
+	id, err := intParam(c, "id", "id")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if !authorizeSignals(c, []int{id}) {
+		return
+	}
+
+	signal, err := store.GetSignalByID(id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	startExport(c, id, "", export.ZIP)
+	if err = export.WriteBundle(c.Writer, *signal, format, time.Now()); err != nil {
+		log.Printf("failed to export signal %d : %s", id, err)
+	}
+}
+
+// ExportSignalDataset streams the dataset parameter of the signal ID parameter in the format
+// query parameter, csv by default. Only the owner of the signal or an admin can export it.
+func ExportSignalDataset(c *gin.Context) {
+	dataset, format := c.Param("dataset"), c.DefaultQuery("format", export.CSV)
+	if err := export.Check(dataset, format); err != nil {
+		c.Error(err)
+		return
+	}
+
+	id, err := intParam(c, "id", "id")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if !authorizeSignals(c, []int{id}) {
+		return
+	}
+
+	if _, err = store.GetSignalByID(id); err != nil {
+		c.Error(err)
+		return
+	}
+
+	startExport(c, id, dataset, format)
+	if _, err = export.WriteDataset(c.Writer, id, dataset, format); err != nil {
+		log.Printf("failed to export %s of signal %d : %s", dataset, id, err)
+	}
+}
+
+// startExport writes the headers of an export download. The errors occurring once the rows
+// are streamed cannot change the status anymore, so they truncate the download instead.
+func startExport(c *gin.Context, signalID int, dataset, format string) {
+	c.Header("Content-Type", export.ContentType(format))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", export.Filename(signalID, dataset, format)))
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,251 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/heroku/stocksignals/engine"
+	"github.com/heroku/stocksignals/model"
+	"github.com/heroku/stocksignals/store"
+)
+
+const (
+	// COPY_BATCH is the number of pending orders copied to the followers at once.
+	COPY_BATCH = 100
+
+	// COPY_INTERVAL is the interval between the copies of the pending orders when the copier is not
+	// woken up, for the orders registered from the command line.
+	COPY_INTERVAL = time.Minute
+)
+
+// copies wakes the copier up when orders are registered.
+var copies = make(chan struct{}, 1)
+
+// GetFollowers retrieves the followers of the authenticated user
+func GetFollowers(c *gin.Context) {
+	followers, err := store.GetFollowersByUserID(currentClaims(c).UserID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, followers)
+}
+
+// CreateFollower starts copying the orders of the given signal to a new portfolio of the
+// authenticated user. The user must be subscribed to the signal.
+func CreateFollower(c *gin.Context) {
+	var follower model.Follower
+	if err := bindJSON(c, &follower); err != nil {
+		c.Error(err)
+		return
+	}
+
+	userID := currentClaims(c).UserID
+	subscribed, err := store.IsSubscribed(userID, follower.LeaderID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if !subscribed {
+		abortWithError(c, FORBIDDEN, "a subscription to the signal is required to follow it")
+		return
+	}
+
+	result, err := store.CreateFollower(userID, follower.LeaderID, follower.Capital, follower.Slippage)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	engine.PublishStats(result.SignalID)
+
+	c.JSON(http.StatusOK, result)
+}
+
+// StopFollower stops copying the orders to the follower ID parameter of the authenticated user
+func StopFollower(c *gin.Context) {
+	id, err := intParam(c, "id", "id")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err = store.StopFollower(id, currentClaims(c).UserID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "follower is stopped"})
+}
+
+// followerUpdate is the body of the follower updates. Stopping is the only supported update.
+type followerUpdate struct {
+	Status string `json:"status" binding:"required"`
+}
+
+// UpdateFollower updates the follower ID parameter of the authenticated user
+func UpdateFollower(c *gin.Context) {
+	id, err := intParam(c, "id", "id")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var update followerUpdate
+	if err = bindJSON(c, &update); err != nil {
+		c.Error(err)
+		return
+	}
+
+	if update.Status != model.STOPPED {
+		c.Error(store.Invalid("status", "status can only be updated to %s", model.STOPPED))
+		return
+	}
+
+	if err = store.StopFollower(id, currentClaims(c).UserID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	follower, err := store.GetFollowerByID(id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, follower)
+}
+
+// GetCopyTrades retrieves the copied and skipped orders of the given follower
+func GetCopyTrades(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(invalidParam("id", err))
+		return
+	}
+
+	follower, err := store.GetFollowerByID(id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if follower.UserID != user.ID && !user.IsAdmin() {
+		abortWithError(c, FORBIDDEN, "follower %d does not belong to the user", id)
+		return
+	}
+
+	trades, err := store.GetCopyTrades(id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, trades)
+}
+
+// queueCopies wakes the copier up to copy the orders which were queued by their registration.
+// It never blocks: the orders are kept in the pending copies until they are copied.
+func queueCopies() {
+	select {
+	case copies <- struct{}{}:
+	default:
+	}
+}
+
+// runCopier copies the pending orders, then again whenever it is woken up or every COPY_INTERVAL
+// until the given context is done, and a last time before returning. The orders left by a crash are copied
+// on the next start.
+func runCopier(ctx context.Context) {
+	ticker := time.NewTicker(COPY_INTERVAL)
+	defer ticker.Stop()
+
+	copyPendingOrders()
+	for {
+		select {
+		case <-ticker.C:
+			copyPendingOrders()
+		case <-copies:
+			copyPendingOrders()
+		case <-ctx.Done():
+			copyPendingOrders()
+			return
+		}
+	}
+}
+
+// copyPendingOrders copies the pending orders in batches of COPY_BATCH until none are left.
+func copyPendingOrders() {
+	for {
+		orders, err := store.GetPendingCopies(COPY_BATCH)
+		if err != nil {
+			log.Printf("failed to read pending copies : %s", err)
+			return
+		}
+
+		if len(orders) == 0 || copyOrders(orders) == 0 {
+			return
+		}
+	}
+}
+
+// copyOrders mirrors the given pending orders on the portfolios of the active followers of their
+// signals, publishes the copied orders and the skipped copies, and removes the orders from the pending copies. The orders
+// whose followers cannot be read are left pending. It returns the number of orders removed.
+func copyOrders(orders []model.Order) int {
+	followersBySignal := make(map[int][]model.Follower)
+	for _, signalID := range engine.OrderSignalIDs(orders) {
+		followers, err := store.GetActiveFollowersByLeaderID(signalID)
+		if err != nil {
+			log.Printf("failed to read followers of signal %d : %s", signalID, err)
+			continue
+		}
+		followersBySignal[signalID] = followers
+	}
+
+	var copied []model.Order
+	removed := 0
+	for _, order := range orders {
+		followers, ok := followersBySignal[order.SignalID]
+		if !ok {
+			continue
+		}
+
+		for _, follower := range followers {
+			trade, copiedOrder, err := store.MirrorOrder(follower, order)
+			if err != nil {
+				log.Printf("failed to copy order %d to follower %d : %s", order.ID, follower.ID, err)
+				continue
+			}
+
+			if copiedOrder != nil {
+				copied = append(copied, *copiedOrder)
+			} else if trade != nil {
+				engine.PublishSkippedCopy(order.SignalID, *trade)
+			}
+		}
+
+		if err := store.DeletePendingCopy(order.ID); err != nil {
+			log.Printf("failed to remove pending copy of order %d : %s", order.ID, err)
+			continue
+		}
+		removed++
+	}
+
+	if len(copied) > 0 {
+		engine.PublishOrders(copied)
+	}
+	return removed
+}
@@ -11,77 +11,74 @@ import (
 	"github.com/heroku/stocksignals/store"
 )
 
-// GetHoldingsBySignalID retrieves the holdings by signal ID parameter
+// GetHoldingsBySignalID retrieves the holdings by signal ID parameter.
+// Only the owner of the signal or an admin can see its holdings.
 func GetHoldingsBySignalID(c *gin.Context) {
-	if err := store.Connect(); err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
-		return
-	}
-	defer store.Disconnect()
-
 	field := c.DefaultQuery("field", "")
 	orderStr := c.DefaultQuery("order", "true")
 	order, err := strconv.ParseBool(orderStr)
 	if err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+		c.Error(invalidParam("order", err))
 		return
 	}
 
-	idStr := c.Query("signal_id")
-	id, err := strconv.Atoi(idStr)
+	id, err := intParam(c, "id", "signal_id")
 	if err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+		c.Error(err)
+		return
+	}
+
+	if !authorizeSignals(c, []int{id}) {
 		return
 	}
 
 	holding, err := store.GetHoldingsBySignalID(id, field, order)
 	if err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+		c.Error(err)
 		return
 	}
 
 	c.JSON(http.StatusOK, holding)
 }
 
+// GetPortfolioBySignalID retrieves the holdings valued with the current prices and the stats by signal ID parameter.
+// Only the owner of the signal or an admin can see its portfolio.
 func GetPortfolioBySignalID(c *gin.Context) {
-	if err := store.Connect(); err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+	id, err := intParam(c, "id", "signal_id")
+	if err != nil {
+		c.Error(err)
 		return
 	}
-	defer store.Disconnect()
 
-	idStr := c.Query("signal_id")
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+	if !authorizeSignals(c, []int{id}) {
 		return
 	}
 
 	signal, err := store.GetSignalByID(id)
 	if err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+		c.Error(err)
 		return
 	}
 
 	if signal == nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("signal with id %s does not exist", id))
+		c.Error(store.NotFound("signal with id %d does not exist", id))
 		return
 	}
 
 	holdings, err := store.GetHoldingsBySignalID(id, "", true)
 	if err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+		c.Error(err)
 		return
 	}
 
 	stats, err := store.GetLatestStats(id)
 	if err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+		c.Error(err)
 		return
 	}
 
 	if err = computePortfolio(stats, holdings); err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+		c.Error(err)
 		return
 	}
 
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/heroku/stocksignals/store"
+)
+
+const (
+	// IDEMPOTENCY_KEY_HEADER is the header of the client keys making a request safe to retry.
+	IDEMPOTENCY_KEY_HEADER = "Idempotency-Key"
+
+	// IDEMPOTENT_REPLAYED_HEADER is set on the responses replayed for a retried request.
+	IDEMPOTENT_REPLAYED_HEADER = "Idempotent-Replayed"
+
+	// MAX_IDEMPOTENCY_KEY_SIZE is the greatest length of an idempotency key.
+	MAX_IDEMPOTENCY_KEY_SIZE = 255
+)
+
+// idempotencyWriter keeps a copy of the response body to save it with the idempotency key
+type idempotencyWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotencyWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *idempotencyWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotent makes the requests with an Idempotency-Key header safe to retry. The first request
+// with a key runs and its response is saved; the retries with the same key and the same method,
+// URL and body replay that response until the key expires, while a reuse of the key for another
+// request is rejected. The server errors and the panics are not saved, so that the request can be
+// retried, and a key left in progress by a crash is taken over once its lock times out.
+// The keys are scoped to the authenticated user.
+func Idempotent() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.Request.Header.Get(IDEMPOTENCY_KEY_HEADER)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		if len(key) > MAX_IDEMPOTENCY_KEY_SIZE {
+			abortWithError(c, store.VALIDATION, "%s header must be at most %d characters", IDEMPOTENCY_KEY_HEADER, MAX_IDEMPOTENCY_KEY_SIZE)
+			return
+		}
+
+		body, err := ioutil.ReadAll(c.Request.Body)
+		if err != nil {
+			abortWithError(c, store.VALIDATION, "failed to read request body : %s", err)
+			return
+		}
+		c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		hash := sha256.New()
+		hash.Write([]byte(c.Request.Method + " " + c.Request.URL.RequestURI() + "\n"))
+		hash.Write(body)
+		requestHash := hex.EncodeToString(hash.Sum(nil))
+
+		userID := currentClaims(c).UserID
+		now := time.Now()
+		existing, err := store.ClaimIdempotencyKey(userID, key, requestHash, now.Unix(),
+			now.Add(conf.Idempotency.LockTimeout).Unix(), now.Add(conf.Idempotency.TTL).Unix())
+		if err != nil {
+			c.Error(err)
+			c.Abort()
+			return
+		}
+
+		if existing != nil {
+			switch {
+			case existing.RequestHash != requestHash:
+				abortWithError(c, IDEMPOTENCY_MISMATCH, "%s %q is already used by another request", IDEMPOTENCY_KEY_HEADER, key)
+			case existing.Status == 0:
+				abortWithError(c, store.CONFLICT, "the request with %s %q is still in progress", IDEMPOTENCY_KEY_HEADER, key)
+			default:
+				c.Header(IDEMPOTENT_REPLAYED_HEADER, "true")
+				c.Data(existing.Status, existing.ContentType, []byte(existing.Response))
+				c.Abort()
+			}
+			return
+		}
+
+		writer := &idempotencyWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		defer func() {
+			recovered := recover()
+			if recovered != nil || c.Writer.Status() >= http.StatusInternalServerError {
+				err = store.ReleaseIdempotencyKey(userID, key)
+			} else {
+				err = store.SaveIdempotentResponse(userID, key, c.Writer.Status(), c.Writer.Header().Get("Content-Type"), writer.body.Bytes())
+			}
+
+			if err != nil {
+				log.Printf("failed to complete idempotency key %q of user %d : %s", key, userID, err)
+			}
+
+			if recovered != nil {
+				panic(recovered)
+			}
+		}()
+
+		c.Next()
+		writeError(c)
+	}
+}
+
+// purgeIdempotencyKeys deletes the expired idempotency keys.
+func purgeIdempotencyKeys() {
+	if _, err := store.DeleteExpiredIdempotencyKeys(time.Now()); err != nil {
+		log.Printf("failed to purge idempotency keys : %s", err)
+	}
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/heroku/stocksignals/config"
+	"github.com/heroku/stocksignals/engine"
+	"github.com/heroku/stocksignals/importer"
+	"github.com/heroku/stocksignals/stockapi"
+	"github.com/heroku/stocksignals/store"
+	"github.com/heroku/stocksignals/validation"
+)
+
+// ImportOrders registers the orders of the broker CSV statement in the request body to the signal
+// ID parameter, reading its columns with the configured mapping named by the mapping query parameter.
+// With the dry_run query parameter, the orders are previewed like PreviewOrders instead. The
+// imported orders are past orders, so they are not copied to the followers. Only the owner of
+// the signal or an admin can import orders.
+func ImportOrders(c *gin.Context) {
+	id, err := intParam(c, "id", "id")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	name := c.DefaultQuery("mapping", config.DEFAULT_IMPORT_MAPPING)
+	mapping, ok := conf.Import.Mappings[name]
+	if !ok {
+		c.Error(store.Invalid("mapping", "unknown import mapping %s", name))
+		return
+	}
+
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		c.Error(invalidParam("dry_run", err))
+		return
+	}
+
+	if !authorizeSignals(c, []int{id}) {
+		return
+	}
+
+	now := time.Now()
+	orders, err := importer.Parse(c.Request.Body, mapping, id, conf.Import.MaxRows, now)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err = validation.Orders(orders, now); err != nil {
+		c.Error(err)
+		return
+	}
+
+	preparedOrders, err := stockapi.PrepareOrders(orders, now)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if dryRun {
+		previewOrders(c, preparedOrders)
+		return
+	}
+
+	registered, err := engine.RegisterOrders(preparedOrders, currentClaims(c).UserID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "orders are imported", "orders": registered})
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/heroku/stocksignals/ranking"
+	"github.com/heroku/stocksignals/store"
+)
+
+// GetLeaderboard retrieves the cached ranking of the signals over the window query
+// parameter, 30d by default, optionally limited to its first entries
+func GetLeaderboard(c *gin.Context) {
+	r, err := ranking.Get(c.DefaultQuery("window", ranking.WINDOW_30D), conf.Ranking)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if limitStr := c.Query("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil {
+			c.Error(invalidParam("limit", err))
+			return
+		}
+
+		if limit < 0 {
+			c.Error(store.Invalid("limit", "limit must not be negative"))
+			return
+		}
+
+		if limit < len(r.Entries) {
+			limited := *r
+			limited.Entries = r.Entries[:limit]
+			r = &limited
+		}
+	}
+
+	c.JSON(http.StatusOK, r)
+}
+
+// refreshRankings recomputes the cached rankings of all windows.
+func refreshRankings() {
+	if err := ranking.Refresh(time.Now(), conf.Ranking); err != nil {
+		log.Printf("failed to refresh rankings : %s", err)
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/heroku/stocksignals/model"
+	"github.com/heroku/stocksignals/store"
+	"github.com/heroku/stocksignals/webhook"
+)
+
+// DEFAULT_DELIVERIES_LIMIT is the default number of notification deliveries returned.
+const DEFAULT_DELIVERIES_LIMIT = 50
+
+// GetNotificationChannels retrieves the notification channels of the authenticated user
+func GetNotificationChannels(c *gin.Context) {
+	channels, err := store.GetNotificationChannelsByUserID(currentClaims(c).UserID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, channels)
+}
+
+// RegisterNotificationChannel registers a notification channel for the authenticated user.
+// The webhook targets are checked like the signal webhooks.
+func RegisterNotificationChannel(c *gin.Context) {
+	var channel model.NotificationChannel
+	if err := bindJSON(c, &channel); err != nil {
+		c.Error(err)
+		return
+	}
+
+	if channel.Kind == model.WEBHOOK {
+		if err := webhook.CheckURL(channel.Target); err != nil {
+			c.Error(store.Invalid("target", "invalid webhook url : %s", err))
+			return
+		}
+	}
+
+	channel.UserID = currentClaims(c).UserID
+	result, err := store.RegisterNotificationChannel(channel)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// DeleteNotificationChannel deletes the notification channel ID parameter of the authenticated user
+func DeleteNotificationChannel(c *gin.Context) {
+	id, err := intParam(c, "id", "id")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err = store.DeleteNotificationChannel(id, currentClaims(c).UserID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "notification channel is deleted"})
+}
+
+// GetDeliveries retrieves the latest notification deliveries of the authenticated user
+func GetDeliveries(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(DEFAULT_DELIVERIES_LIMIT)))
+	if err != nil {
+		c.Error(invalidParam("limit", err))
+		return
+	}
+
+	deliveries, err := store.GetDeliveriesByUserID(currentClaims(c).UserID, limit)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
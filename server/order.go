@@ -4,78 +4,88 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/heroku/stocksignals/engine"
 	"github.com/heroku/stocksignals/model"
 	"github.com/heroku/stocksignals/stockapi"
 	"github.com/heroku/stocksignals/store"
+	"github.com/heroku/stocksignals/validation"
 )
 
-// GetOrdersBySignalID retrieves the orders by signal ID parameter
+// GetOrdersBySignalID retrieves a page of the orders by signal ID parameter,
+// optionally filtered by time range, order type and stock code
 func GetOrdersBySignalID(c *gin.Context) {
-	if err := store.Connect(); err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
-		return
-	}
-	defer store.Disconnect()
-
 	field := c.DefaultQuery("field", "")
 	orderStr := c.DefaultQuery("order", "true")
 	order, err := strconv.ParseBool(orderStr)
 	if err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+		c.Error(invalidParam("order", err))
 		return
 	}
 
-	idStr := c.Query("signal_id")
-	id, err := strconv.Atoi(idStr)
+	id, err := intParam(c, "id", "signal_id")
 	if err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+		c.Error(err)
 		return
 	}
 
-	orders, err := store.GetOrdersBySignalID(id, field, order)
+	from, to, err := timeRangeParam(c)
 	if err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, orders)
-}
+	page, err := pageParam(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
 
-// RegisterOrders registers the given orders
-func RegisterOrders(c *gin.Context) {
-	var err error
-	if err = store.Connect(); err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+	filter := store.OrderFilter{
+		SignalID: id,
+		From:     from,
+		To:       to,
+		Type:     c.Query("type"),
+		Code:     c.Query("code"),
+	}
+	orders, next, err := store.ListOrders(filter, field, order, page)
+	if err != nil {
+		c.Error(err)
 		return
 	}
-	defer store.Disconnect()
 
-	var orders []model.Order
-	if err = c.BindJSON(&orders); err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+	writePage(c, orders, next)
+}
+
+// RegisterOrders registers the given orders and queues them to be copied to the followers of their signals.
+// With the dry_run query parameter, it previews the orders like PreviewOrders instead.
+// Only the owner of the signals or an admin can register orders.
+func RegisterOrders(c *gin.Context) {
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		c.Error(invalidParam("dry_run", err))
 		return
 	}
 
-	if len(orders) == 0 {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("no order is given to register"))
+	orders, ok := bindOrders(c)
+	if !ok {
 		return
 	}
 
-	preparedOrders, err := prepareOrders(orders)
-	if err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+	if dryRun {
+		previewOrders(c, orders)
 		return
 	}
 
-	if err := store.RegisterOrders(preparedOrders); err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+	if _, err = engine.RegisterOrders(orders, currentClaims(c).UserID); err != nil {
+		c.Error(err)
 		return
 	}
 
+	queueCopies()
+
 	if len(orders) == 1 {
 		c.JSON(http.StatusOK, gin.H{"status": "order is registered"})
 	} else {
@@ -83,78 +93,115 @@ func RegisterOrders(c *gin.Context) {
 	}
 }
 
-func prepareOrders(orders []model.Order) ([]model.Order, error) {
-	var list []model.Order
-	for _, order := range orders {
-		names, err := stockapi.GetNames([]string{order.Code})
-		if err != nil {
-			return nil, err
-		}
-		order.Name = names[0]
-
-		var prices []float64
-		switch order.Type {
-		case model.BUY, model.ADD:
-			prices, err = stockapi.GetAskPrices([]string{order.Code})
-		case model.SELL, model.REDUCE:
-			prices, err = stockapi.GetBidPrices([]string{order.Code})
-		}
+// PreviewOrders executes the given orders without saving them and returns them with the
+// resulting holdings, funds, profit and growth of their signals. The orders are not copied
+// to the followers. Only the owner of the signals or an admin can preview orders.
+func PreviewOrders(c *gin.Context) {
+	if orders, ok := bindOrders(c); ok {
+		previewOrders(c, orders)
+	}
+}
+
+func previewOrders(c *gin.Context, orders []model.Order) {
+	executed, portfolios, err := store.SimulateOrders(orders, currentClaims(c).UserID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"dry_run": true, "orders": executed, "portfolios": portfolios})
+}
 
+// bindOrders reads the orders of the request body, checks them and the authorization of the user
+// on their signals, then prepares them. It reports the errors and returns false if they are not valid.
+func bindOrders(c *gin.Context) ([]model.Order, bool) {
+	var orders []model.Order
+	if err := bindJSON(c, &orders); err != nil {
+		c.Error(err)
+		return nil, false
+	}
+
+	// The versioned routes register the orders to the signal in their path
+	if c.Param("id") != "" {
+		signalID, err := intParam(c, "id", "id")
 		if err != nil {
-			return nil, err
+			c.Error(err)
+			return nil, false
 		}
 
-		if order.Price == 0 && len(prices) > 0 {
-			order.Price = prices[0]
+		for i := range orders {
+			if orders[i].SignalID == 0 {
+				orders[i].SignalID = signalID
+			} else if orders[i].SignalID != signalID {
+				c.Error(store.Invalid(fmt.Sprintf("[%d].signal_id", i), "must be %d on this route", signalID))
+				return nil, false
+			}
 		}
+	}
 
-		if order.Time == 0 {
-			order.Time = time.Now().Unix()
-			order.PastOrder = false
-		} else {
-			order.PastOrder = true
-		}
+	// Reject the invalid orders before looking up any quote
+	if err := validation.Orders(orders, time.Now()); err != nil {
+		c.Error(err)
+		return nil, false
+	}
+
+	if !authorizeSignals(c, engine.OrderSignalIDs(orders)) {
+		return nil, false
+	}
 
-		list = append(list, order)
+	preparedOrders, err := stockapi.PrepareOrders(orders, time.Now())
+	if err != nil {
+		c.Error(err)
+		return nil, false
 	}
 
-	return list, nil
+	return preparedOrders, true
 }
 
 // DeleteOrdersByID deletes the orders by ID parameter. Note that
 // it does not clean up the stats, holdings related with this orders.
+// Only the owner of the signals or an admin can delete their orders.
 func DeleteOrdersByID(c *gin.Context) {
-	if err := store.Connect(); err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+	ids, err := intListParam(c, "order_id", "id")
+	if err != nil {
+		c.Error(err)
 		return
 	}
-	defer store.Disconnect()
 
-	idsStr := c.Query("id")
-	idsStrArr := strings.Split(idsStr, ",")
-
-	if len(idsStrArr) == 0 {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("no order id is given"))
-		return
+	// The versioned route deletes the order of the signal in its path
+	var signalID int
+	if c.Param("id") != "" {
+		if signalID, err = intParam(c, "id", "id"); err != nil {
+			c.Error(err)
+			return
+		}
 	}
 
-	var ids []int
-	for _, idStr := range idsStrArr {
-		id, err := strconv.Atoi(idStr)
+	var orders []model.Order
+	for _, id := range ids {
+		order, err := store.GetOrderByID(id)
 		if err != nil {
-			c.String(http.StatusInternalServerError, err.Error())
+			c.Error(err)
+			return
+		}
+
+		if signalID != 0 && order.SignalID != signalID {
+			c.Error(store.NotFound("order with id %d does not exist in signal %d", id, signalID))
 			return
 		}
-		ids = append(ids, id)
+		orders = append(orders, *order)
 	}
 
-	err := store.DeleteOrdersByID(ids)
-	if err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+	if !authorizeSignals(c, engine.OrderSignalIDs(orders)) {
+		return
+	}
+
+	if err = store.DeleteOrdersByID(ids, currentClaims(c).UserID); err != nil {
+		c.Error(err)
 		return
 	}
 
-	if len(idsStrArr) == 1 {
+	if len(ids) == 1 {
 		c.JSON(http.StatusOK, gin.H{"status": "order is deleted"})
 	} else {
 		c.JSON(http.StatusOK, gin.H{"status": "orders are deleted"})
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/heroku/stocksignals/store"
+)
+
+// API_V1 is the prefix of the versioned routes.
+const API_V1 = "/api/v1"
+
+// intParam reads the integer of the given path parameter, or of the given query
+// parameter on the legacy routes which do not have it in their path.
+func intParam(c *gin.Context, param, query string) (int, error) {
+	name, value := param, c.Param(param)
+	if value == "" {
+		name, value = query, c.Query(query)
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, invalidParam(name, err)
+	}
+	return i, nil
+}
+
+// intListParam reads the integers of the given path parameter, or the comma
+// separated integers of the given query parameter on the legacy routes.
+func intListParam(c *gin.Context, param, query string) ([]int, error) {
+	name, value := param, c.Param(param)
+	if value == "" {
+		name, value = query, c.Query(query)
+	}
+
+	if value == "" {
+		return nil, store.Invalid(name, "no %s is given", name)
+	}
+
+	var list []int
+	for _, str := range strings.Split(value, ",") {
+		i, err := strconv.Atoi(str)
+		if err != nil {
+			return nil, invalidParam(name, err)
+		}
+		list = append(list, i)
+	}
+	return list, nil
+}
+
+// PageEnvelope is the response of the paginated list routes
+type PageEnvelope struct {
+	Data       interface{} `json:"data"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// pageParam reads the limit and cursor query parameters. The versioned routes
+// return DEFAULT_PAGE_LIMIT rows when no limit is given, the legacy ones all the rows.
+func pageParam(c *gin.Context) (store.Page, error) {
+	page := store.Page{Cursor: c.Query("cursor")}
+	if isV1(c) {
+		page.Limit = store.DEFAULT_PAGE_LIMIT
+	}
+
+	if limitStr := c.Query("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil {
+			return page, invalidParam("limit", err)
+		}
+		page.Limit = limit
+	}
+	return page, nil
+}
+
+// timeRangeParam reads the optional from and to query parameters, in unix seconds
+func timeRangeParam(c *gin.Context) (int64, int64, error) {
+	var bounds [2]int64
+	for i, name := range []string{"from", "to"} {
+		if str := c.Query(name); str != "" {
+			bound, err := strconv.ParseInt(str, 10, 64)
+			if err != nil {
+				return 0, 0, invalidParam(name, err)
+			}
+			bounds[i] = bound
+		}
+	}
+
+	if bounds[0] != 0 && bounds[1] != 0 && bounds[0] > bounds[1] {
+		return 0, 0, store.Invalid("from", "from must not be after to")
+	}
+	return bounds[0], bounds[1], nil
+}
+
+// writePage writes the given page of a list. The versioned routes wrap it in
+// a PageEnvelope, the legacy ones return the plain list with the next cursor
+// in the X-Next-Cursor header.
+func writePage(c *gin.Context, data interface{}, next string) {
+	if isV1(c) {
+		c.JSON(http.StatusOK, PageEnvelope{Data: data, NextCursor: next})
+		return
+	}
+
+	if next != "" {
+		c.Header("X-Next-Cursor", next)
+	}
+	c.JSON(http.StatusOK, data)
+}
+
+// isV1 reports whether the request is made to a versioned route
+func isV1(c *gin.Context) bool {
+	return strings.HasPrefix(c.Request.URL.Path, API_V1+"/")
+}
+
+// deprecated marks the responses of a legacy route as deprecated in favour of the given route
+func deprecated(successor string) gin.HandlerFunc {
+	link := fmt.Sprintf("<%s%s>; rel=\"successor-version\"", API_V1, successor)
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "true")
+		c.Header("Link", link)
+		c.Next()
+	}
+}
@@ -2,20 +2,41 @@ package server
 
 import (
 	"bytes"
-	"fmt"
+	"context"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/heroku/stocksignals/billing"
+	"github.com/heroku/stocksignals/config"
+	"github.com/heroku/stocksignals/engine"
+	"github.com/heroku/stocksignals/stockapi"
+	"github.com/heroku/stocksignals/store"
 )
 
 var (
 	// ErrorMarshalJSONOutput is returned when an error occurs on marshalling a
 	// JSONOutput object.
 	ErrorMarshalJSONOutput = "Expect marshal [%v] to json but failed: %s "
+
+	conf = config.Default()
+
+	gateway billing.Gateway
+
+	// delivery delivers the changes on the signals to the notifications and the webhooks.
+	delivery *engine.Delivery
+
+	// searcher searches the signals. The tests can replace it with a store.MemorySearch.
+	searcher store.SignalSearch = store.PostgresSearch{}
+
+	// done is closed when the server shuts down, to end the open streams.
+	done <-chan struct{}
 )
 
 // stocksignals the web server
@@ -26,57 +47,285 @@ func WelcomeStockSignals(c *gin.Context) {
 	c.String(http.StatusOK, buffer.String())
 }
 
-func Run() {
-	port := os.Getenv("PORT")
-	if port == "" {
-		log.Fatal("$PORT must be set")
+// Run starts the web server and the background jobs with the given
+// configuration. It blocks until the process receives SIGTERM or SIGINT, then
+// drains the in-flight requests, stops the background jobs and closes the
+// database connection.
+func Run(cfg *config.Config) error {
+	conf = cfg
+	stockapi.Configure(cfg.Quotes)
+
+	var err error
+	if gateway, err = billing.NewGateway(cfg.Billing.Gateway); err != nil {
+		return err
 	}
 
-	router := gin.New()
-	router.Use(gin.Logger())
+	if err = store.Connect(cfg.Database); err != nil {
+		return err
+	}
+	defer store.Disconnect()
 
-	router.GET("/", WelcomeStockSignals)
+	srv := &http.Server{
+		Addr:         ":" + cfg.Port,
+		Handler:      withoutLongWriteDeadline(newRouter()),
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+	}
 
-	router.GET("/signals", GetSignals)
-	router.POST("/signals", RegisterSignals)
-	router.GET("/signal", GetSignalByID)
-	router.DELETE("/signals", DeleteSignalsByID)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	router.GET("/users", GetUsers)
-	router.POST("/user", RegisterUser)
-	router.GET("/user/:email", GetUserByEmail)
+	streams, closeStreams := context.WithCancel(context.Background())
+	defer closeStreams()
+	done = streams.Done()
 
-	router.GET("/orders", GetOrdersBySignalID)
-	router.POST("/orders", RegisterOrders)
-	router.DELETE("/orders", DeleteOrdersByID)
+	delivery = engine.StartDelivery(ctx, cfg)
+	defer delivery.Close()
 
-	router.GET("/holdings", GetHoldingsBySignalID)
+	var wg sync.WaitGroup
+	wg.Add(5)
+	go func() {
+		defer wg.Done()
+		runPeriodically(ctx, cfg.Scheduler.StatsInterval, saveStats)
+	}()
 
-	router.GET("/stats", GetLatestStatsBySignalID)
-	router.GET("/stats_all", GetAllStatsBySignalID)
-	router.POST("/stats_save", SaveSignalStats)
+	go func() {
+		defer wg.Done()
+		runPeriodically(ctx, cfg.Billing.Interval, generateInvoices)
+	}()
 
-	router.GET("/portfolio", GetPortfolioBySignalID)
+	go func() {
+		defer wg.Done()
+		runPeriodically(ctx, cfg.Ranking.Interval, refreshRankings)
+	}()
 
-	var wg sync.WaitGroup
-	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		router.Run(":" + port)
+		runPeriodically(ctx, cfg.Idempotency.TTL, purgeIdempotencyKeys)
 	}()
 
-	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		saveStats(port)
+		runCopier(ctx)
+	}()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			serverErr <- err
+		}
 	}()
 
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(quit)
+
+	select {
+	case sig := <-quit:
+		log.Printf("received %s, shutting down", sig)
+	case err = <-serverErr:
+		log.Printf("server failed, shutting down : %s", err)
+	}
+
+	// The streams are ended first so that the in-flight requests can drain, then the background
+	// jobs are stopped once no request can queue more work for them.
+	closeStreams()
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancelShutdown()
+	if errShutdown := srv.Shutdown(shutdownCtx); errShutdown != nil {
+		log.Printf("failed to drain in-flight requests : %s", errShutdown)
+	}
+
+	cancel()
 	wg.Wait()
+	return err
+}
+
+// withoutLongWriteDeadline lifts the write timeout of the server for the event streams, which stay
+// open for as long as the client listens, and for the exports, which stream whole signal histories.
+// It is set on the server writer since the gin writer cannot reach it.
+func withoutLongWriteDeadline(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		long := strings.HasSuffix(path, "/stream") || strings.HasSuffix(path, "/export") || strings.Contains(path, "/export/")
+		if r.Method == http.MethodGet && long {
+			http.NewResponseController(w).SetWriteDeadline(time.Time{})
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func newRouter() *gin.Engine {
+	router := gin.New()
+	router.Use(gin.Logger())
+	router.Use(HandleErrors())
+
+	router.GET("/", WelcomeStockSignals)
+
+	registerV1Routes(router.Group(API_V1))
+	registerLegacyRoutes(router)
+
+	return router
+}
+
+// registerV1Routes registers the versioned resource routes to the given group
+func registerV1Routes(v1 *gin.RouterGroup) {
+	v1.POST("/login", Login)
+
+	authorized := v1.Group("/", RequireAuth())
+	authorized.POST("/token/refresh", RefreshToken)
+	authorized.POST("/logout", Logout)
+
+	v1.GET("/signals", GetSignals)
+	authorized.POST("/signals", RegisterSignals)
+	v1.GET("/signals/:id", GetSignalByID)
+	authorized.PATCH("/signals/:id", UpdateSignal)
+	authorized.DELETE("/signals/:id", ArchiveSignals)
+	authorized.GET("/signals/:id/audit", GetSignalAuditLog)
+	v1.GET("/signals/:id/stream", RequireStreamAuth(), StreamSignal)
+	authorized.POST("/signals/:id/stream/token", IssueStreamToken)
+	v1.GET("/search/signals", SearchSignals)
+
+	v1.GET("/signals/:id/orders", GetOrdersBySignalID)
+	authorized.POST("/signals/:id/orders", Idempotent(), RegisterOrders)
+	authorized.POST("/signals/:id/orders/preview", PreviewOrders)
+	authorized.DELETE("/signals/:id/orders/:order_id", DeleteOrdersByID)
+	authorized.POST("/signals/:id/imports", ImportOrders)
+
+	authorized.GET("/signals/:id/holdings", GetHoldingsBySignalID)
+	authorized.GET("/signals/:id/portfolio", GetPortfolioBySignalID)
+	authorized.GET("/signals/:id/export", ExportSignal)
+	authorized.GET("/signals/:id/export/:dataset", ExportSignalDataset)
+
+	v1.GET("/signals/:id/stats", GetLatestStatsBySignalID)
+	v1.GET("/signals/:id/stats/history", GetAllStatsBySignalID)
+	authorized.POST("/stats/snapshots", SaveSignalStats)
+
+	v1.GET("/leaderboard", GetLeaderboard)
+
+	v1.GET("/users", GetUsers)
+	v1.POST("/users", RegisterUser)
+	v1.GET("/users/:email", GetUserByEmail)
+
+	authorized.GET("/subscriptions", GetSubscriptions)
+	authorized.POST("/subscriptions", Subscribe)
+	authorized.DELETE("/subscriptions/:signal_id", Unsubscribe)
+
+	authorized.GET("/invoices", GetInvoices)
+	authorized.POST("/invoices/:id/pay", PayInvoice)
+	authorized.GET("/revenue", GetRevenue)
+
+	authorized.GET("/notifications/channels", GetNotificationChannels)
+	authorized.POST("/notifications/channels", RegisterNotificationChannel)
+	authorized.DELETE("/notifications/channels/:id", DeleteNotificationChannel)
+	authorized.GET("/notifications/deliveries", GetDeliveries)
+
+	authorized.GET("/webhooks", GetWebhooks)
+	authorized.POST("/webhooks", RegisterWebhook)
+	authorized.DELETE("/webhooks/:id", DeleteWebhook)
+	authorized.GET("/webhooks/dead_letters", GetDeadLetters)
+	authorized.POST("/webhooks/dead_letters/:id/replay", ReplayDeadLetter)
+
+	authorized.GET("/followers", GetFollowers)
+	authorized.POST("/followers", CreateFollower)
+	authorized.PATCH("/followers/:id", UpdateFollower)
+	authorized.DELETE("/followers/:id", StopFollower)
+	authorized.GET("/followers/:id/copy_trades", GetCopyTrades)
+
+	authorized.GET("/admin/signals/archived", GetArchivedSignals)
+	authorized.POST("/admin/signals/:id/restore", RestoreSignal)
+	authorized.POST("/admin/signals/:id/purge", PurgeSignal)
+	authorized.GET("/admin/exports/:id", GetSignalExport)
 }
 
-func saveStats(port string) {
+// registerLegacyRoutes registers the unversioned routes. They are kept as deprecated
+// aliases of the versioned routes for the existing clients.
+func registerLegacyRoutes(router *gin.Engine) {
+	router.POST("/login", deprecated("/login"), Login)
+
+	authorized := router.Group("/", RequireAuth())
+	authorized.POST("/token/refresh", deprecated("/token/refresh"), RefreshToken)
+	authorized.POST("/logout", deprecated("/logout"), Logout)
+
+	router.GET("/signals", deprecated("/signals"), GetSignals)
+	authorized.POST("/signals", deprecated("/signals"), RegisterSignals)
+	router.GET("/signal", deprecated("/signals/:id"), GetSignalByID)
+	router.GET("/signals/:id/stream", deprecated("/signals/:id/stream"), RequireStreamAuth(), StreamSignal)
+	authorized.DELETE("/signals", deprecated("/signals/:id"), ArchiveSignals)
+
+	router.GET("/users", deprecated("/users"), GetUsers)
+	router.POST("/user", deprecated("/users"), RegisterUser)
+	router.GET("/user/:email", deprecated("/users/:email"), GetUserByEmail)
+
+	authorized.GET("/subscriptions", deprecated("/subscriptions"), GetSubscriptions)
+	authorized.POST("/subscriptions", deprecated("/subscriptions"), Subscribe)
+	authorized.DELETE("/subscriptions", deprecated("/subscriptions/:signal_id"), Unsubscribe)
+
+	authorized.GET("/invoices", deprecated("/invoices"), GetInvoices)
+	authorized.POST("/invoices/:id/pay", deprecated("/invoices/:id/pay"), PayInvoice)
+	authorized.GET("/revenue", deprecated("/revenue"), GetRevenue)
+
+	authorized.GET("/notifications/channels", deprecated("/notifications/channels"), GetNotificationChannels)
+	authorized.POST("/notifications/channels", deprecated("/notifications/channels"), RegisterNotificationChannel)
+	authorized.DELETE("/notifications/channels", deprecated("/notifications/channels/:id"), DeleteNotificationChannel)
+	authorized.GET("/notifications/deliveries", deprecated("/notifications/deliveries"), GetDeliveries)
+
+	authorized.GET("/webhooks", deprecated("/webhooks"), GetWebhooks)
+	authorized.POST("/webhooks", deprecated("/webhooks"), RegisterWebhook)
+	authorized.DELETE("/webhooks", deprecated("/webhooks/:id"), DeleteWebhook)
+	authorized.GET("/webhooks/dead_letters", deprecated("/webhooks/dead_letters"), GetDeadLetters)
+	authorized.POST("/webhooks/dead_letters/:id/replay", deprecated("/webhooks/dead_letters/:id/replay"), ReplayDeadLetter)
+
+	authorized.GET("/followers", deprecated("/followers"), GetFollowers)
+	authorized.POST("/followers", deprecated("/followers"), CreateFollower)
+	authorized.DELETE("/followers", deprecated("/followers/:id"), StopFollower)
+	authorized.GET("/followers/:id/copy_trades", deprecated("/followers/:id/copy_trades"), GetCopyTrades)
+
+	router.GET("/orders", deprecated("/signals/:id/orders"), GetOrdersBySignalID)
+	authorized.POST("/orders", deprecated("/signals/:id/orders"), Idempotent(), RegisterOrders)
+	authorized.POST("/orders/preview", deprecated("/signals/:id/orders/preview"), PreviewOrders)
+	authorized.DELETE("/orders", deprecated("/signals/:id/orders/:order_id"), DeleteOrdersByID)
+
+	authorized.GET("/holdings", deprecated("/signals/:id/holdings"), GetHoldingsBySignalID)
+
+	router.GET("/stats", deprecated("/signals/:id/stats"), GetLatestStatsBySignalID)
+	router.GET("/stats_all", deprecated("/signals/:id/stats/history"), GetAllStatsBySignalID)
+	authorized.POST("/stats_save", deprecated("/stats/snapshots"), SaveSignalStats)
+
+	authorized.GET("/portfolio", deprecated("/signals/:id/portfolio"), GetPortfolioBySignalID)
+}
+
+// runPeriodically runs the given job now and then every interval until the given context is done.
+func runPeriodically(ctx context.Context, interval time.Duration, job func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
 	for {
-		http.Post(fmt.Sprintf("http://127.0.0.1:%s/stats_save", port), "", nil)
-		time.Sleep(6 * time.Hour)
+		job()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// saveStats saves the stats of all signals.
+func saveStats() {
+	snapshot, err := engine.SaveAllStats(conf.Scheduler.StatsConcurrency)
+	if err != nil {
+		log.Printf("failed to save signals stats : %s", err)
+	} else if len(snapshot.Failed) > 0 {
+		log.Printf("failed to save stats for %d signals : %v", len(snapshot.Failed), snapshot.Failed)
+	}
+}
+
+// generateInvoices generates the invoices of the subscriptions.
+func generateInvoices() {
+	if err := billing.GenerateInvoices(time.Now(), conf.Billing.InvoiceDue); err != nil {
+		log.Printf("failed to generate invoices : %s", err)
 	}
 }
@@ -9,54 +9,78 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/heroku/stocksignals/model"
 	"github.com/heroku/stocksignals/store"
+	"github.com/heroku/stocksignals/validation"
 )
 
-// GetSignals retrieves the signals from the user
+// GetSignals retrieves a page of the signals ordered by the field parameter
 func GetSignals(c *gin.Context) {
-	if err := store.Connect(); err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
-		return
-	}
-	defer store.Disconnect()
-
 	field := c.DefaultQuery("field", "")
 	orderStr := c.DefaultQuery("order", "true")
 	order, err := strconv.ParseBool(orderStr)
 	if err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+		c.Error(invalidParam("order", err))
+		return
+	}
+
+	page, err := pageParam(c)
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
-	signals, err := store.GetSignals(field, order)
+	signals, next, err := store.ListSignals(field, order, page)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	writePage(c, signals, next)
+}
+
+// SearchSignals retrieves the signals matching the q query parameter in their name, description,
+// tags or held stock symbols, and having all the tag query parameters, best match first
+func SearchSignals(c *gin.Context) {
+	limit := store.DEFAULT_PAGE_LIMIT
+	if limitStr := c.Query("limit"); limitStr != "" {
+		var err error
+		if limit, err = strconv.Atoi(limitStr); err != nil {
+			c.Error(invalidParam("limit", err))
+			return
+		}
+	}
+
+	signals, err := searcher.Search(store.SearchQuery{
+		Text:  c.Query("q"),
+		Tags:  c.QueryArray("tag"),
+		Limit: limit,
+	})
 	if err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, signals)
+	c.JSON(http.StatusOK, PageEnvelope{Data: signals})
 }
 
 // RegisterSignals register the given signal
 func RegisterSignals(c *gin.Context) {
-	if err := store.Connect(); err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+	if !authorizeRoles(c, model.ADMIN, model.PROVIDER) {
 		return
 	}
-	defer store.Disconnect()
 
 	var signals []model.Signal
-	if err := c.BindJSON(&signals); err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+	if err := bindJSON(c, &signals); err != nil {
+		c.Error(err)
 		return
 	}
 
-	if len(signals) == 0 {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("no signals is given"))
+	if err := validation.Signals(signals); err != nil {
+		c.Error(err)
 		return
 	}
 
-	if err := store.RegisterSignals(signals); err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+	if err := store.RegisterSignals(signals, currentClaims(c).UserID); err != nil {
+		c.Error(err)
 		return
 	}
 
@@ -69,63 +93,219 @@ func RegisterSignals(c *gin.Context) {
 
 // GetSignalByID retrieves the signals by ID parameter
 func GetSignalByID(c *gin.Context) {
-	if err := store.Connect(); err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
-		return
-	}
-	defer store.Disconnect()
-
-	idStr := c.Query("id")
-	id, err := strconv.Atoi(idStr)
+	id, err := intParam(c, "id", "id")
 	if err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+		c.Error(err)
 		return
 	}
 
 	signal, err := store.GetSignalByID(id)
 	if err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+		c.Error(err)
 		return
 	}
 
+	c.Header("ETag", signalETag(signal))
 	c.JSON(http.StatusOK, signal)
 }
 
-// DeleteSignalsByID deletes the signals (orders, holdings and stats) by ID parameter
-func DeleteSignalsByID(c *gin.Context) {
-	if err := store.Connect(); err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+// UpdateSignal updates the metadata of the signal ID parameter. The version the update is
+// based on is given by the If-Match header, or by the version field of the update.
+// Only the owner of the signal or an admin can update it.
+func UpdateSignal(c *gin.Context) {
+	id, err := intParam(c, "id", "id")
+	if err != nil {
+		c.Error(err)
 		return
 	}
-	defer store.Disconnect()
 
-	idsStr := c.Query("id")
-	idsStrArr := strings.Split(idsStr, ",")
+	if !authorizeSignals(c, []int{id}) {
+		return
+	}
 
-	if len(idsStrArr) == 0 {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("no signal id is given"))
+	var update model.SignalUpdate
+	if err = bindJSON(c, &update); err != nil {
+		c.Error(err)
 		return
 	}
 
-	var ids []int
-	for _, idStr := range idsStrArr {
-		id, err := strconv.Atoi(idStr)
-		if err != nil {
-			c.String(http.StatusInternalServerError, err.Error())
+	if err = validation.SignalUpdate(update); err != nil {
+		c.Error(err)
+		return
+	}
+
+	version := update.Version
+	if ifMatch := c.Request.Header.Get("If-Match"); ifMatch != "" {
+		if version, err = parseETag(ifMatch); err != nil {
+			c.Error(err)
 			return
 		}
-		ids = append(ids, id)
 	}
 
-	err := store.DeleteSignalsByID(ids)
+	if version == 0 {
+		c.Error(store.Invalid("version", "the If-Match header or the version of the signal is required"))
+		return
+	}
+
+	signal, err := store.UpdateSignal(id, version, update, currentClaims(c).UserID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Header("ETag", signalETag(signal))
+	c.JSON(http.StatusOK, signal)
+}
+
+// GetSignalAuditLog retrieves a page of the audit log of the signal ID parameter, latest first.
+// Only the owner of the signal or an admin can read it.
+func GetSignalAuditLog(c *gin.Context) {
+	id, err := intParam(c, "id", "id")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if !authorizeSignals(c, []int{id}) {
+		return
+	}
+
+	page, err := pageParam(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	entries, next, err := store.ListAuditLog(id, page)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	writePage(c, entries, next)
+}
+
+// signalETag returns the entity tag of the given version of the signal
+func signalETag(signal *model.Signal) string {
+	return fmt.Sprintf("\"%d\"", signal.Version)
+}
+
+// parseETag returns the signal version of the given entity tag
+func parseETag(tag string) (int, error) {
+	tag = strings.Trim(strings.TrimPrefix(strings.TrimSpace(tag), "W/"), "\"")
+	version, err := strconv.Atoi(tag)
+	if err != nil {
+		return 0, invalidParam("If-Match", err)
+	}
+	return version, nil
+}
+
+// ArchiveSignals archives the signals by ID parameter, keeping their history.
+// Only the owner of the signals or an admin can archive them.
+func ArchiveSignals(c *gin.Context) {
+	ids, err := intListParam(c, "id", "id")
 	if err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+		c.Error(err)
 		return
 	}
 
-	if len(idsStrArr) == 1 {
-		c.JSON(http.StatusOK, gin.H{"status": "signal is deleted"})
+	if !authorizeSignals(c, ids) {
+		return
+	}
+
+	if err = store.ArchiveSignals(ids, currentClaims(c).UserID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	if len(ids) == 1 {
+		c.JSON(http.StatusOK, gin.H{"status": "signal is archived"})
 	} else {
-		c.JSON(http.StatusOK, gin.H{"status": "signals are deleted"})
+		c.JSON(http.StatusOK, gin.H{"status": "signals are archived"})
+	}
+}
+
+// GetArchivedSignals retrieves a page of the archived signals. Only admins can list them.
+func GetArchivedSignals(c *gin.Context) {
+	if !authorizeRoles(c, model.ADMIN) {
+		return
+	}
+
+	page, err := pageParam(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	signals, next, err := store.ListArchivedSignals(page)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	writePage(c, signals, next)
+}
+
+// RestoreSignal restores the archived signal ID parameter. Only admins can restore signals.
+func RestoreSignal(c *gin.Context) {
+	if !authorizeRoles(c, model.ADMIN) {
+		return
 	}
+
+	id, err := intParam(c, "id", "id")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	signal, err := store.RestoreSignal(id, currentClaims(c).UserID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, signal)
+}
+
+// PurgeSignal permanently deletes the archived signal ID parameter with its history,
+// after saving its export. Only admins can purge signals.
+func PurgeSignal(c *gin.Context) {
+	if !authorizeRoles(c, model.ADMIN) {
+		return
+	}
+
+	id, err := intParam(c, "id", "id")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	exportID, err := store.PurgeSignal(id, currentClaims(c).UserID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "signal is purged", "export_id": exportID})
+}
+
+// GetSignalExport retrieves the export saved when a signal was purged. Only admins can read it.
+func GetSignalExport(c *gin.Context) {
+	if !authorizeRoles(c, model.ADMIN) {
+		return
+	}
+
+	id, err := intParam(c, "id", "id")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	export, err := store.GetSignalExport(id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, export)
 }
@@ -5,80 +5,84 @@ import (
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/heroku/stocksignals/engine"
+	"github.com/heroku/stocksignals/model"
 	"github.com/heroku/stocksignals/store"
 )
 
 // GetLatestStatsBySignalID retrieves the latest stats by signal ID parameter
 func GetLatestStatsBySignalID(c *gin.Context) {
-	if err := store.Connect(); err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
-		return
-	}
-	defer store.Disconnect()
-
-	idStr := c.Query("signal_id")
-	id, err := strconv.Atoi(idStr)
+	id, err := intParam(c, "id", "signal_id")
 	if err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+		c.Error(err)
 		return
 	}
 
 	stats, err := store.GetLatestStats(id)
 	if err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+		c.Error(err)
 		return
 	}
 
 	c.JSON(http.StatusOK, stats)
 }
 
-// GetAllStatsBySignalID retrieves the latest stats by signal ID parameter
+// GetAllStatsBySignalID retrieves a page of the stats history by signal ID parameter,
+// latest first and optionally filtered by time range
 func GetAllStatsBySignalID(c *gin.Context) {
-	if err := store.Connect(); err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+	id, err := intParam(c, "id", "signal_id")
+	if err != nil {
+		c.Error(err)
 		return
 	}
-	defer store.Disconnect()
 
-	idStr := c.Query("signal_id")
-	id, err := strconv.Atoi(idStr)
+	from, to, err := timeRangeParam(c)
 	if err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+		c.Error(err)
 		return
 	}
 
-	stats, err := store.GetAllStats(id)
+	page, err := pageParam(c)
 	if err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, stats)
+	stats, next, err := store.ListStats(store.StatsFilter{SignalID: id, From: from, To: to}, page)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	writePage(c, stats, next)
 }
 
+// SaveSignalStats saves a new stats snapshot for every signal and reports which signals failed.
+// Only admins can trigger a snapshot.
 func SaveSignalStats(c *gin.Context) {
-	if err := store.Connect(); err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+	if !authorizeRoles(c, model.ADMIN) {
 		return
 	}
-	defer store.Disconnect()
 
-	signals, err := store.GetSignals("", true)
+	concurrencyStr := c.DefaultQuery("concurrency", strconv.Itoa(conf.Scheduler.StatsConcurrency))
+	concurrency, err := strconv.Atoi(concurrencyStr)
 	if err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+		c.Error(invalidParam("concurrency", err))
 		return
 	}
 
-	errFound := false
-	for _, signal := range signals {
-		err = store.SaveStats(signal.ID)
-		if err != nil {
-			c.String(http.StatusInternalServerError, err.Error())
-			errFound = true
-		}
+	snapshot, err := engine.SaveAllStats(concurrency)
+	if err != nil {
+		c.Error(err)
+		return
 	}
 
-	if !errFound {
-		c.JSON(http.StatusOK, gin.H{"status": "signals stats are saved successfully"})
+	switch {
+	case len(snapshot.Failed) == 0:
+		c.JSON(http.StatusOK, gin.H{"status": "signals stats are saved successfully", "result": snapshot})
+	case len(snapshot.Saved) == 0:
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed to save signals stats", "result": snapshot})
+	default:
+		c.JSON(http.StatusMultiStatus, gin.H{"status": "some signals stats could not be saved", "result": snapshot})
 	}
 }
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/heroku/stocksignals/auth"
+	"github.com/heroku/stocksignals/engine"
+	"github.com/heroku/stocksignals/events"
+	"github.com/heroku/stocksignals/model"
+	"github.com/heroku/stocksignals/store"
+	"github.com/manucorporat/sse"
+)
+
+const (
+	// STREAM_BUFFER is the number of events waiting to be written to a stream.
+	STREAM_BUFFER = 64
+
+	// STREAM_HEARTBEAT is the interval of the comments keeping an idle stream
+	// open. The Heroku router closes connections idle for 55 seconds.
+	STREAM_HEARTBEAT = 20 * time.Second
+
+	// STREAM_TOKEN_TTL is how long a stream token can be used to open the stream of a signal.
+	// The open streams are not closed when it expires.
+	STREAM_TOKEN_TTL = time.Minute
+)
+
+// streamCursor is the position of a stream in the orders and stats of a signal.
+// It is sent as the id of the events as "<order id>-<stats id>".
+type streamCursor struct {
+	orderID int
+	statsID int
+}
+
+func (s streamCursor) String() string {
+	return fmt.Sprintf("%d-%d", s.orderID, s.statsID)
+}
+
+func parseStreamCursor(id string) (streamCursor, error) {
+	parts := strings.Split(id, "-")
+	if len(parts) != 2 {
+		return streamCursor{}, fmt.Errorf("invalid last event id %q", id)
+	}
+
+	orderID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return streamCursor{}, fmt.Errorf("invalid last event id %q", id)
+	}
+
+	statsID, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return streamCursor{}, fmt.Errorf("invalid last event id %q", id)
+	}
+
+	return streamCursor{orderID: orderID, statsID: statsID}, nil
+}
+
+// streamScope is the scope of the stream tokens of the given signal id
+func streamScope(id string) string {
+	return "stream:" + id
+}
+
+// IssueStreamToken issues a short-lived token opening the stream of the signal ID parameter for
+// the authenticated user, to be given in the token query parameter of the stream by the clients
+// which cannot set its Authorization header.
+func IssueStreamToken(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(invalidParam("id", err))
+		return
+	}
+
+	if _, err = store.GetSignalByID(id); err != nil {
+		c.Error(err)
+		return
+	}
+
+	claims := currentClaims(c)
+	token, streamClaims, err := auth.NewScopedToken([]byte(conf.Auth.TokenSecret), claims.UserID, claims.Email,
+		streamScope(strconv.Itoa(id)), STREAM_TOKEN_TTL)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"token": token, "expires_at": streamClaims.ExpiresAt})
+}
+
+// StreamSignal streams the new orders, portfolios and stats of the signal ID
+// parameter as server-sent events. A client reconnecting with the
+// Last-Event-ID header first receives the orders and stats it missed. The
+// orders and stats saved by other processes, like the command line tool, are
+// caught up with on every heartbeat.
+// The portfolios are only streamed to the owner of the signal or an admin,
+// and the private signals of the copy-trading followers only to them.
+// Besides the bearer token, the stream accepts a token from IssueStreamToken
+// in the token query parameter.
+func StreamSignal(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(invalidParam("id", err))
+		return
+	}
+
+	signal, err := store.GetSignalByID(id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	owner := user.IsAdmin() || signal.OwnedBy(user.ID)
+	if signal.Follower && !owner {
+		abortWithError(c, FORBIDDEN, "signal %d is not owned by the user", id)
+		return
+	}
+
+	// Subscribe before reading the missed events so that none is lost in between
+	subscription := engine.Bus.Subscribe(id, STREAM_BUFFER)
+	defer subscription.Close()
+
+	var cursor streamCursor
+	var missed []events.Event
+	if lastEventID := c.Request.Header.Get("Last-Event-ID"); lastEventID != "" {
+		if cursor, err = parseStreamCursor(lastEventID); err != nil {
+			c.Error(invalidParam("Last-Event-ID", err))
+			return
+		}
+
+		if missed, err = missedEvents(id, cursor); err != nil {
+			c.Error(err)
+			return
+		}
+	} else {
+		if cursor.orderID, err = store.GetLastOrderID(id); err != nil {
+			c.Error(err)
+			return
+		}
+
+		if cursor.statsID, err = store.GetLastStatsID(id); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+
+	c.Header("Content-Type", sse.ContentType)
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	heartbeat := time.NewTicker(STREAM_HEARTBEAT)
+	defer heartbeat.Stop()
+
+	write := func(event events.Event) {
+		if (event.Type == events.PORTFOLIO || event.Type == events.COPY_SKIPPED) && !owner {
+			return
+		}
+
+		switch data := event.Data.(type) {
+		case model.Order:
+			if data.ID <= cursor.orderID {
+				return
+			}
+			cursor.orderID = data.ID
+		case *model.Stats:
+			if data.ID <= cursor.statsID {
+				return
+			}
+			cursor.statsID = data.ID
+		}
+
+		sse.Encode(c.Writer, sse.Event{Id: cursor.String(), Event: event.Type, Data: event.Data})
+	}
+
+	for _, event := range missed {
+		write(event)
+	}
+	c.Writer.Flush()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-done:
+			return false
+		case event, ok := <-subscription.C:
+			if !ok {
+				return false
+			}
+			write(event)
+		case <-heartbeat.C:
+			caughtUp, err := missedEvents(id, cursor)
+			if err != nil {
+				log.Printf("failed to catch up stream of signal %d : %s", id, err)
+			}
+
+			for _, event := range caughtUp {
+				write(event)
+			}
+			io.WriteString(w, ": heartbeat\n\n")
+		}
+		return true
+	})
+}
+
+// missedEvents returns the order and stats events of the given signal after the given cursor.
+func missedEvents(signalID int, cursor streamCursor) ([]events.Event, error) {
+	orders, err := store.GetOrdersAfterID(signalID, cursor.orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := store.GetStatsAfterID(signalID, cursor.statsID)
+	if err != nil {
+		return nil, err
+	}
+
+	var missed []events.Event
+	for _, order := range orders {
+		missed = append(missed, events.Event{Type: events.ORDER, SignalID: signalID, Time: order.Time, Data: order})
+	}
+
+	for i := range stats {
+		missed = append(missed, events.Event{Type: events.STATS, SignalID: signalID, Time: stats[i].Time, Data: &stats[i]})
+	}
+
+	return missed, nil
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/heroku/stocksignals/model"
+	"github.com/heroku/stocksignals/store"
+)
+
+// GetSubscriptions retrieves the subscriptions of the authenticated user, optionally filtered by status
+func GetSubscriptions(c *gin.Context) {
+	status := c.DefaultQuery("status", "")
+
+	subscriptions, err := store.GetSubscriptionsByUserID(currentClaims(c).UserID, status)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, subscriptions)
+}
+
+// Subscribe subscribes the authenticated user to the given signal
+func Subscribe(c *gin.Context) {
+	var subscription model.Subscription
+	if err := bindJSON(c, &subscription); err != nil {
+		c.Error(err)
+		return
+	}
+
+	result, err := store.Subscribe(currentClaims(c).UserID, subscription.SignalID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// Unsubscribe cancels the subscription of the authenticated user to the signal ID parameter
+func Unsubscribe(c *gin.Context) {
+	id, err := intParam(c, "signal_id", "signal_id")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err = store.Unsubscribe(currentClaims(c).UserID, id); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "subscription is cancelled"})
+}
@@ -9,38 +9,38 @@ import (
 	"github.com/heroku/stocksignals/store"
 )
 
-// GetSignals retrieves the signals from the user
+// GetUsers retrieves a page of the users without their passwords
 func GetUsers(c *gin.Context) {
-	if err := store.Connect(); err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+	page, err := pageParam(c)
+	if err != nil {
+		c.Error(err)
 		return
 	}
-	defer store.Disconnect()
 
-	users, err := store.GetUsers()
+	users, next, err := store.ListUsers(page)
 	if err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, users)
+	publicUsers := []model.PublicUser{}
+	for _, user := range users {
+		publicUsers = append(publicUsers, user.Public())
+	}
+
+	writePage(c, publicUsers, next)
 }
 
 // RegisterUser registers the given user on the database
 func RegisterUser(c *gin.Context) {
-	if err := store.Connect(); err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
-		return
-	}
-
 	var user model.User
-	if err := c.BindJSON(&user); err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+	if err := bindJSON(c, &user); err != nil {
+		c.Error(err)
 		return
 	}
 
 	if err := store.RegisterUser(user); err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+		c.Error(err)
 		return
 	}
 
@@ -49,17 +49,12 @@ func RegisterUser(c *gin.Context) {
 
 // GetUserByEmail gets the given user info from the database via email
 func GetUserByEmail(c *gin.Context) {
-	if err := store.Connect(); err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
-		return
-	}
-
 	email := c.Param("email")
 	user, err := store.GetUser(email)
 	if err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, user)
+	c.JSON(http.StatusOK, user.Public())
 }
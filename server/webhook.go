@@ -0,0 +1,111 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/heroku/stocksignals/model"
+	"github.com/heroku/stocksignals/store"
+	"github.com/heroku/stocksignals/webhook"
+)
+
+// GetWebhooks retrieves the webhooks of the authenticated user
+func GetWebhooks(c *gin.Context) {
+	webhooks, err := store.GetWebhooksByUserID(currentClaims(c).UserID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, webhooks)
+}
+
+// RegisterWebhook registers a webhook of the authenticated user for the order and stats events of a signal.
+// The owner of the signal, an admin or a subscriber of the signal can register webhooks.
+// The secret signing the payloads is only returned in this response.
+func RegisterWebhook(c *gin.Context) {
+	var hook model.Webhook
+	if err := bindJSON(c, &hook); err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := webhook.CheckURL(hook.URL); err != nil {
+		c.Error(store.Invalid("url", "invalid webhook url : %s", err))
+		return
+	}
+
+	hook.UserID = currentClaims(c).UserID
+	subscribed, err := store.IsSubscribed(hook.UserID, hook.SignalID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if !subscribed && !authorizeSignals(c, []int{hook.SignalID}) {
+		return
+	}
+
+	if hook.Secret, err = webhook.NewSecret(); err != nil {
+		c.Error(err)
+		return
+	}
+
+	result, err := store.RegisterWebhook(hook)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// DeleteWebhook deletes the webhook ID parameter of the authenticated user
+func DeleteWebhook(c *gin.Context) {
+	id, err := intParam(c, "id", "id")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err = store.DeleteWebhook(id, currentClaims(c).UserID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "webhook is deleted"})
+}
+
+// GetDeadLetters retrieves the undelivered payloads of the webhooks of the authenticated user
+func GetDeadLetters(c *gin.Context) {
+	deadLetters, err := store.GetDeadLettersByUserID(currentClaims(c).UserID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, deadLetters)
+}
+
+// ReplayDeadLetter delivers the dead letter ID parameter of the authenticated user again
+func ReplayDeadLetter(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(invalidParam("id", err))
+		return
+	}
+
+	deadLetter, err := delivery.Webhooks.Replay(id, currentClaims(c).UserID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if deadLetter.ReplayedTime == nil {
+		c.JSON(http.StatusBadGateway, deadLetter)
+		return
+	}
+
+	c.JSON(http.StatusOK, deadLetter)
+}
@@ -5,9 +5,12 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"time"
 	//"strings"
 
 	"github.com/buger/jsonparser"
+	"github.com/heroku/stocksignals/config"
+	"github.com/heroku/stocksignals/model"
 )
 
 const (
@@ -15,6 +18,19 @@ const (
 	BASE_STOCK_URI = "https://api.iextrading.com/1.0/tops/last?symbols=%s"
 )
 
+var (
+	baseURI = BASE_STOCK_URI
+	client  = http.DefaultClient
+)
+
+// Configure sets the quote provider URI and request timeout.
+func Configure(cfg config.QuotesConfig) {
+	if cfg.BaseURI != "" {
+		baseURI = cfg.BaseURI
+	}
+	client = &http.Client{Timeout: cfg.Timeout}
+}
+
 // GetAskPrices queries the yahoo api and returns the current ask price for that stocks.
 func GetAskPrices(stocks []string) ([]float64, error) {
 	pricesStr, err := getStocksResponses(stocks, "a")
@@ -63,28 +79,61 @@ func GetNames(stocks []string) ([]string, error) {
 	return names, nil
 }
 
-func getStocksResponses(stocks []string, option string) ([]string, error) {
-	stocksStr := ""
-	if len(stocks) <= 0 {
-		return nil, fmt.Errorf("length of codes cannot be less than 1")
-	}
-
-	for i, stock := range stocks {
-		if i == 0 {
-			stocksStr = stock
+// GetBidPriceMap queries the stock api once for the given stocks and returns
+// the current bid prices keyed by stock code, and the codes the api returns no
+// price for, like delisted stocks. Duplicate codes are queried once.
+func GetBidPriceMap(stocks []string) (map[string]float64, []string, error) {
+	var codes []string
+	seen := make(map[string]bool)
+	for _, stock := range stocks {
+		if seen[stock] {
 			continue
 		}
-		stocksStr += "," + stock
+		seen[stock] = true
+		codes = append(codes, stock)
 	}
 
-	response, err := http.Get(fmt.Sprintf(BASE_STOCK_URI, stocksStr))
+	responseData, err := getStocksResponseData(codes, "b")
 	if err != nil {
-		return nil, fmt.Errorf("failed to get stock response for option %s : %s", option, err)
+		return nil, nil, err
 	}
 
-	responseData, err := ioutil.ReadAll(response.Body)
+	prices := make(map[string]float64)
+	var errParser error
+	jsonparser.ArrayEach(responseData, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+		symbol, err := jsonparser.GetString(value, "symbol")
+		if err != nil {
+			errParser = fmt.Errorf("failed to parse stock response data to get symbol names : %s", err)
+			return
+		}
+
+		price, err := jsonparser.GetFloat(value, "price")
+		if err != nil {
+			errParser = fmt.Errorf("failed to parse stock response data to get symbol prices : %s", err)
+			return
+		}
+
+		prices[symbol] = price
+	})
+
+	if errParser != nil {
+		return nil, nil, errParser
+	}
+
+	var missing []string
+	for _, code := range codes {
+		if _, ok := prices[code]; !ok {
+			missing = append(missing, code)
+		}
+	}
+
+	return prices, missing, nil
+}
+
+func getStocksResponses(stocks []string, option string) ([]string, error) {
+	responseData, err := getStocksResponseData(stocks, option)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read stock response data : %s", err)
+		return nil, err
 	}
 
 	var array []string
@@ -114,3 +163,80 @@ func getStocksResponses(stocks []string, option string) ([]string, error) {
 
 	return array, nil
 }
+
+func getStocksResponseData(stocks []string, option string) ([]byte, error) {
+	stocksStr := ""
+	if len(stocks) <= 0 {
+		return nil, fmt.Errorf("length of codes cannot be less than 1")
+	}
+
+	for i, stock := range stocks {
+		if i == 0 {
+			stocksStr = stock
+			continue
+		}
+		stocksStr += "," + stock
+	}
+
+	response, err := client.Get(fmt.Sprintf(baseURI, stocksStr))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stock response for option %s : %s", option, err)
+	}
+	defer response.Body.Close()
+
+	responseData, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stock response data : %s", err)
+	}
+
+	return responseData, nil
+}
+
+// PrepareOrders fills in the stock names, the current quote of the orders without a price and
+// the given time of the orders without a time. The names are looked up once per stock.
+func PrepareOrders(orders []model.Order, now time.Time) ([]model.Order, error) {
+	var list []model.Order
+	names := make(map[string]string)
+	for _, order := range orders {
+		name, ok := names[order.Code]
+		if !ok {
+			found, err := GetNames([]string{order.Code})
+			if err != nil {
+				return nil, err
+			}
+			name = found[0]
+			names[order.Code] = name
+		}
+		order.Name = name
+
+		var prices []float64
+		var err error
+		if order.Price == 0 {
+			switch order.Type {
+			case model.BUY, model.ADD:
+				prices, err = GetAskPrices([]string{order.Code})
+			case model.SELL, model.REDUCE:
+				prices, err = GetBidPrices([]string{order.Code})
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if order.Price == 0 && len(prices) > 0 {
+			order.Price = prices[0]
+		}
+
+		if order.Time == 0 {
+			order.Time = now.Unix()
+			order.PastOrder = false
+		} else {
+			order.PastOrder = true
+		}
+
+		list = append(list, order)
+	}
+
+	return list, nil
+}
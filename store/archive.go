@@ -0,0 +1,218 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/heroku/stocksignals/model"
+)
+
+// ArchiveSignals archives the given signals of the given user. Their history is kept, but
+// their subscriptions are cancelled, their followers are stopped and they become read-only.
+func ArchiveSignals(ids []int, userID int) error {
+	if db == nil {
+		return fmt.Errorf("no connection is created to the database")
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin signal archival : %s", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+	for _, id := range ids {
+		signal, err := lockSignal(id, tx)
+		if err != nil {
+			return err
+		}
+
+		if signal.Archived() {
+			return Conflict("signal %d is already archived", id)
+		}
+
+		if _, err = tx.Exec("UPDATE signals SET archived_time = $1 WHERE id = $2", now, id); err != nil {
+			return fmt.Errorf("failed to archive signal : %s", err)
+		}
+
+		_, err = tx.Exec("UPDATE subscriptions SET status = $1, end_time = $2 WHERE signal_id = $3 AND status = $4",
+			model.CANCELLED, now, id, model.ACTIVE)
+		if err != nil {
+			return fmt.Errorf("failed to cancel subscriptions : %s", err)
+		}
+
+		if err = updateNumSubscribers(id, tx); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("UPDATE followers SET status = $1 WHERE (leader_id = $2 OR signal_id = $2) AND status = $3",
+			model.STOPPED, id, model.ACTIVE)
+		if err != nil {
+			return fmt.Errorf("failed to stop followers : %s", err)
+		}
+
+		if err = writeAudit(tx, userID, id, model.SIGNAL_ARCHIVE, id, map[string]int64{"archived_time": now}); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to complete signal archival : %s", err)
+	}
+
+	return nil
+}
+
+// RestoreSignal makes the given archived signal visible and writable again.
+// The cancelled subscriptions and stopped followers are not resumed.
+func RestoreSignal(id, userID int) (*model.Signal, error) {
+	if db == nil {
+		return nil, fmt.Errorf("no connection is created to the database")
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin signal restoration : %s", err)
+	}
+	defer tx.Rollback()
+
+	signal, err := lockSignal(id, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !signal.Archived() {
+		return nil, Conflict("signal %d is not archived", id)
+	}
+
+	if _, err = tx.Exec("UPDATE signals SET archived_time = NULL WHERE id = $1", id); err != nil {
+		return nil, fmt.Errorf("failed to restore signal : %s", err)
+	}
+
+	if err = writeAudit(tx, userID, id, model.SIGNAL_RESTORE, id, map[string]*int64{"archived_time": nil}); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to complete signal restoration : %s", err)
+	}
+
+	signal.ArchivedTime = nil
+	return signal, nil
+}
+
+// ListArchivedSignals reads a page of the archived signals, latest archived first
+func ListArchivedSignals(page Page) ([]model.Signal, string, error) {
+	q := listQuery{table: "signals"}
+	q.where("archived_time IS NOT NULL")
+
+	results := []model.Signal{}
+	next, err := q.selectPage(&results, "archived_time", true, page)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return results, next, nil
+}
+
+// ExportSignal reads the whole history of the given signal
+func ExportSignal(id int) (*model.SignalExport, error) {
+	signal, err := GetSignalByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	export := model.SignalExport{Signal: *signal}
+	if export.Orders, err = GetOrdersBySignalID(id, "", false); err != nil {
+		return nil, err
+	}
+
+	if export.Holdings, err = GetHoldingsBySignalID(id, "", true); err != nil {
+		return nil, err
+	}
+
+	if export.Stats, err = GetAllStats(id); err != nil {
+		return nil, err
+	}
+
+	if export.AuditLog, _, err = ListAuditLog(id, Page{}); err != nil {
+		return nil, err
+	}
+
+	return &export, nil
+}
+
+// PurgeSignal permanently deletes the given archived signal with all its history,
+// after saving its export. It returns the id of the saved export.
+func PurgeSignal(id, userID int) (int, error) {
+	if db == nil {
+		return 0, fmt.Errorf("no connection is created to the database")
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin signal purge : %s", err)
+	}
+	defer tx.Rollback()
+
+	signal, err := lockSignal(id, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	if !signal.Archived() {
+		return 0, Conflict("signal %d must be archived before it is purged", id)
+	}
+
+	export, err := ExportSignal(id)
+	if err != nil {
+		return 0, err
+	}
+
+	data, err := json.Marshal(export)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode signal export : %s", err)
+	}
+
+	var exportID int
+	err = tx.QueryRow("INSERT INTO signal_exports (signal_id, user_id, data, export_time) VALUES ($1, $2, $3, $4) returning id",
+		id, userID, string(data), time.Now().Unix()).Scan(&exportID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert signal export : %s", err)
+	}
+
+	if err = deleteSignal(id, tx); err != nil {
+		return 0, err
+	}
+
+	if err = writeAudit(tx, userID, id, model.SIGNAL_PURGE, id, map[string]int{"export_id": exportID}); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to complete signal purge : %s", err)
+	}
+
+	return exportID, nil
+}
+
+// GetSignalExport reads the saved export with the given id
+func GetSignalExport(id int) (model.JSONText, error) {
+	if db == nil {
+		return nil, fmt.Errorf("no connection is created to the database")
+	}
+
+	var data model.JSONText
+	err := db.Get(&data, "SELECT data FROM signal_exports WHERE id = $1", id)
+	if err == sql.ErrNoRows {
+		return nil, NotFound("signal export with id %d does not exist.", id)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading signal export %d: %q", id, err)
+	}
+
+	return data, nil
+}
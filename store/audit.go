@@ -0,0 +1,49 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/heroku/stocksignals/model"
+	"github.com/jmoiron/sqlx"
+)
+
+// writeAudit records the given change of a signal made by the given user, or by the system when userID is 0
+func writeAudit(tx *sqlx.Tx, userID, signalID int, action string, entityID int, changes interface{}) error {
+	if tx == nil {
+		return fmt.Errorf("given transaction is nil")
+	}
+
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit changes : %s", err)
+	}
+
+	var user *int
+	if userID != 0 {
+		user = &userID
+	}
+
+	_, err = tx.Exec("INSERT INTO audit_log (user_id, signal_id, action, entity_id, changes, audit_time) "+
+		"VALUES ($1, $2, $3, $4, $5, $6)", user, signalID, action, entityID, string(data), time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to insert audit entry : %s", err)
+	}
+
+	return nil
+}
+
+// ListAuditLog reads a page of the audit entries of the given signal, latest first
+func ListAuditLog(signalID int, page Page) ([]model.AuditEntry, string, error) {
+	q := listQuery{table: "audit_log"}
+	q.where("signal_id = ?", signalID)
+
+	results := []model.AuditEntry{}
+	next, err := q.selectPage(&results, "audit_time", true, page)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return results, next, nil
+}
@@ -0,0 +1,88 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// NOT_FOUND is the code of the errors for missing records.
+	NOT_FOUND = "not_found"
+
+	// CONFLICT is the code of the errors for records clashing with existing ones.
+	CONFLICT = "conflict"
+
+	// VALIDATION is the code of the errors for invalid input.
+	VALIDATION = "validation"
+
+	// VERSION_MISMATCH is the code of the errors for updates based on an outdated version of a record.
+	VERSION_MISMATCH = "version_mismatch"
+
+	// INSUFFICIENT_FUNDS is the code of the errors for orders and withdrawals exceeding the funds or holdings of a signal.
+	INSUFFICIENT_FUNDS = "insufficient_funds"
+
+	// UNIQUE_VIOLATION is the postgres error code of the unique constraint violations.
+	UNIQUE_VIOLATION = "23505"
+)
+
+// Error is an error caused by the request rather than the store. Fields maps
+// the invalid fields of a validation error to their problem.
+type Error struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// NotFound returns a NOT_FOUND error with the given message
+func NotFound(format string, args ...interface{}) *Error {
+	return &Error{Code: NOT_FOUND, Message: fmt.Sprintf(format, args...)}
+}
+
+// Conflict returns a CONFLICT error with the given message
+func Conflict(format string, args ...interface{}) *Error {
+	return &Error{Code: CONFLICT, Message: fmt.Sprintf(format, args...)}
+}
+
+// Invalid returns a VALIDATION error with the given message for the given field.
+// The field is omitted when it is empty.
+func Invalid(field, format string, args ...interface{}) *Error {
+	e := &Error{Code: VALIDATION, Message: fmt.Sprintf(format, args...)}
+	if field != "" {
+		e.Fields = map[string]string{field: e.Message}
+	}
+	return e
+}
+
+// InsufficientFunds returns an INSUFFICIENT_FUNDS error with the given message
+func InsufficientFunds(format string, args ...interface{}) *Error {
+	return &Error{Code: INSUFFICIENT_FUNDS, Message: fmt.Sprintf(format, args...)}
+}
+
+// ErrorCode returns the code of the given error, or an empty string if it is not a store error
+func ErrorCode(err error) string {
+	if e, ok := err.(*Error); ok {
+		return e.Code
+	}
+	return ""
+}
+
+// wrap prefixes the message of the given error with the given one, keeping its code when it is a store error
+func wrap(err error, message string) error {
+	if e, ok := err.(*Error); ok {
+		return &Error{Code: e.Code, Message: message + " : " + e.Message, Fields: e.Fields}
+	}
+	return fmt.Errorf("%s : %s", message, err)
+}
+
+// wrapDB wraps the given database error, reporting unique constraint violations as conflicts
+func wrapDB(err error, message string) error {
+	if e, ok := err.(*pq.Error); ok && e.Code == UNIQUE_VIOLATION {
+		return Conflict("%s : %s", message, e.Message)
+	}
+	return fmt.Errorf("%s : %s", message, err)
+}
@@ -0,0 +1,347 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/heroku/stocksignals/model"
+	"github.com/jmoiron/sqlx"
+)
+
+// CreateFollower creates the portfolio of the given user mirroring the orders
+// of the leader signal. The portfolio is held by a private signal funded with
+// the given capital.
+func CreateFollower(userID, leaderID int, capital, slippage float64) (*model.Follower, error) {
+	if db == nil {
+		return nil, fmt.Errorf("no connection is created to the database")
+	}
+
+	if capital <= 0 {
+		return nil, Invalid("capital", "capital must be greater than 0")
+	}
+
+	if slippage < 0 || slippage >= 100 {
+		return nil, Invalid("slippage", "slippage must be between 0 and 100 percent")
+	}
+
+	leader, err := GetSignalByID(leaderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if leader.Archived() {
+		return nil, Conflict("signal %d is archived", leaderID)
+	}
+
+	if leader.Follower {
+		return nil, Invalid("leader_id", "signal %d is the portfolio of a follower and cannot be followed", leaderID)
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin follower creation : %s", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+	signal := model.Signal{
+		OwnerID:     &userID,
+		Name:        fmt.Sprintf("%s (copied by user %d at %d)", leader.Name, userID, now),
+		Description: fmt.Sprintf("Copy of signal %d", leaderID),
+		Follower:    true,
+	}
+	err = tx.QueryRow("INSERT INTO signals (owner_id, name, description, num_subscribers, price, num_trades, "+
+		"first_trade_time, last_trade_time, is_follower) VALUES ($1, $2, $3, 0, 0, 0, 0, 0, true) returning id",
+		signal.OwnerID, signal.Name, signal.Description).Scan(&signal.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert follower signal : %s", err)
+	}
+
+	// Fund the portfolio, which also creates its first stats
+	deposit := model.Order{SignalID: signal.ID, Time: now, Type: model.DEPOSIT, Profit: capital, PastOrder: true}
+	stats := &model.Stats{SignalID: signal.ID}
+	var holdings []model.Holding
+	if err = registerOrder(&signal, &deposit, stats, &holdings, userID, tx); err != nil {
+		return nil, err
+	}
+
+	follower := model.Follower{
+		UserID:      userID,
+		LeaderID:    leaderID,
+		SignalID:    signal.ID,
+		Capital:     capital,
+		Slippage:    slippage,
+		Status:      model.ACTIVE,
+		CreatedTime: now,
+	}
+	err = tx.QueryRow("INSERT INTO followers (user_id, leader_id, signal_id, capital, slippage, status, created_time) "+
+		"VALUES ($1, $2, $3, $4, $5, $6, $7) returning id",
+		follower.UserID, follower.LeaderID, follower.SignalID, follower.Capital, follower.Slippage,
+		follower.Status, follower.CreatedTime).Scan(&follower.ID)
+	if err != nil {
+		return nil, wrapDB(err, "failed to insert follower")
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to complete follower creation : %s", err)
+	}
+
+	return &follower, nil
+}
+
+// GetFollowersByUserID reads the followers of the given user
+func GetFollowersByUserID(userID int) ([]model.Follower, error) {
+	if db == nil {
+		return nil, fmt.Errorf("no connection is created to the database")
+	}
+
+	var results []model.Follower
+	if err := db.Select(&results, "SELECT * FROM followers WHERE user_id = $1 ORDER BY id", userID); err != nil {
+		return nil, fmt.Errorf("error reading followers: %q", err)
+	}
+
+	return results, nil
+}
+
+// GetActiveFollowersByLeaderID reads the followers copying the orders of the given signal
+// whose users are still subscribed to it
+func GetActiveFollowersByLeaderID(leaderID int) ([]model.Follower, error) {
+	if db == nil {
+		return nil, fmt.Errorf("no connection is created to the database")
+	}
+
+	var results []model.Follower
+	err := db.Select(&results, "SELECT followers.* FROM followers "+
+		"JOIN subscriptions ON subscriptions.user_id = followers.user_id AND subscriptions.signal_id = followers.leader_id "+
+		"WHERE followers.leader_id = $1 AND followers.status = $2 AND subscriptions.status = $2 ORDER BY followers.id",
+		leaderID, model.ACTIVE)
+	if err != nil {
+		return nil, fmt.Errorf("error reading followers: %q", err)
+	}
+
+	return results, nil
+}
+
+// GetFollowerByID reads the follower with the given id
+func GetFollowerByID(id int) (*model.Follower, error) {
+	if db == nil {
+		return nil, fmt.Errorf("no connection is created to the database")
+	}
+
+	var follower model.Follower
+	err := db.Get(&follower, "SELECT * FROM followers WHERE id = $1", id)
+	if err == sql.ErrNoRows {
+		return nil, NotFound("follower %d does not exist", id)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading follower %d: %q", id, err)
+	}
+
+	return &follower, nil
+}
+
+// StopFollower stops copying the orders to the portfolio of the given follower.
+// The portfolio itself is kept.
+func StopFollower(id, userID int) error {
+	if db == nil {
+		return fmt.Errorf("no connection is created to the database")
+	}
+
+	result, err := db.Exec("UPDATE followers SET status = $1 WHERE id = $2 AND user_id = $3 AND status = $4",
+		model.STOPPED, id, userID, model.ACTIVE)
+	if err != nil {
+		return fmt.Errorf("failed to stop follower : %s", err)
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		return NotFound("user %d has no active follower %d", userID, id)
+	}
+
+	return nil
+}
+
+// GetPendingCopies reads at most limit registered orders waiting to be copied to the followers, oldest first
+func GetPendingCopies(limit int) ([]model.Order, error) {
+	if db == nil {
+		return nil, fmt.Errorf("no connection is created to the database")
+	}
+
+	results := []model.Order{}
+	err := db.Select(&results, "SELECT orders.* FROM pending_copies JOIN orders ON orders.id = pending_copies.order_id "+
+		"ORDER BY pending_copies.order_id LIMIT $1", limit)
+	if err != nil {
+		return nil, fmt.Errorf("error reading pending copies: %q", err)
+	}
+
+	return results, nil
+}
+
+// DeletePendingCopy removes the given order from the orders waiting to be copied
+func DeletePendingCopy(orderID int) error {
+	if db == nil {
+		return fmt.Errorf("no connection is created to the database")
+	}
+
+	if _, err := db.Exec("DELETE FROM pending_copies WHERE order_id = $1", orderID); err != nil {
+		return fmt.Errorf("failed to delete pending copy : %s", err)
+	}
+
+	return nil
+}
+
+// MirrorOrder executes the given leader order on the portfolio of the follower,
+// scaled to the follower balance and adjusted with its slippage. Orders which
+// cannot be executed are recorded as skipped. It returns the recorded copy
+// trade and the executed order, which is nil when the order is skipped. Both are
+// nil when the order was already mirrored to the follower.
+func MirrorOrder(follower model.Follower, order model.Order) (*model.CopyTrade, *model.Order, error) {
+	if db == nil {
+		return nil, nil, fmt.Errorf("no connection is created to the database")
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin order mirroring : %s", err)
+	}
+	defer tx.Rollback()
+
+	signal, err := lockSignal(follower.SignalID, tx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stats, err := GetLatestStats(follower.SignalID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if stats == nil {
+		return nil, nil, fmt.Errorf("follower %d has no stats", follower.ID)
+	}
+
+	holdings, err := GetHoldingsBySignalID(follower.SignalID, "", true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var mirrored bool
+	err = tx.Get(&mirrored, "SELECT EXISTS (SELECT 1 FROM copy_trades WHERE follower_id = $1 AND leader_order_id = $2)", follower.ID, order.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading copy trades: %q", err)
+	}
+
+	if mirrored {
+		return nil, nil, nil
+	}
+
+	trade := model.CopyTrade{
+		FollowerID:    follower.ID,
+		LeaderOrderID: order.ID,
+		Status:        model.SKIPPED,
+		Time:          time.Now().Unix(),
+	}
+
+	copied, reason := scaleOrder(follower, order, stats, holdings)
+	if copied != nil {
+		if err = registerOrder(signal, copied, stats, &holdings, 0, tx); err != nil {
+			return nil, nil, err
+		}
+
+		trade.Status = model.COPIED
+		trade.OrderID = &copied.ID
+	}
+	trade.Reason = reason
+
+	err = tx.QueryRow("INSERT INTO copy_trades (follower_id, leader_order_id, order_id, status, reason, copy_time) "+
+		"VALUES ($1, $2, $3, $4, $5, $6) returning id",
+		trade.FollowerID, trade.LeaderOrderID, trade.OrderID, trade.Status, trade.Reason, trade.Time).Scan(&trade.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to insert copy trade : %s", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("failed to complete order mirroring : %s", err)
+	}
+
+	return &trade, copied, nil
+}
+
+// scaleOrder builds the follower order for the given leader order. It returns
+// the reason why the order is skipped when it cannot be copied.
+func scaleOrder(follower model.Follower, order model.Order, stats *model.Stats, holdings []model.Holding) (*model.Order, string) {
+	copied := model.Order{
+		SignalID:  follower.SignalID,
+		Time:      order.Time,
+		Code:      order.Code,
+		Name:      order.Name,
+		PastOrder: order.PastOrder,
+	}
+
+	switch order.Type {
+	case model.BUY, model.ADD:
+		if order.BalanceBefore <= 0 {
+			return nil, "leader balance is not positive"
+		}
+
+		balance := getStockBalance(holdings) + stats.Funds
+		copied.Type = model.BUY
+		copied.Price = order.Price * (1 + follower.Slippage/100)
+		copied.NumShares = int(float64(order.NumShares) * balance / order.BalanceBefore)
+		if copied.NumShares == 0 {
+			return nil, fmt.Sprintf("scaled number of %s shares is 0", order.Code)
+		}
+
+		if cost := float64(copied.NumShares) * copied.Price; cost > stats.Funds {
+			return nil, fmt.Sprintf("insufficient funds : %.2f needed, %.2f available", cost, stats.Funds)
+		}
+	case model.SELL, model.REDUCE:
+		loc := findHolding(order.Code, holdings)
+		if loc == -1 {
+			return nil, fmt.Sprintf("%s stock does not exist in the holdings", order.Code)
+		}
+
+		copied.Type = model.SELL
+		copied.Price = order.Price * (1 - follower.Slippage/100)
+		copied.NumShares = holdings[loc].NumShares
+		if order.NumShares < order.SharesBefore {
+			copied.NumShares = holdings[loc].NumShares * order.NumShares / order.SharesBefore
+		}
+
+		if copied.NumShares == 0 {
+			return nil, fmt.Sprintf("scaled number of %s shares is 0", order.Code)
+		}
+	default:
+		return nil, fmt.Sprintf("%s orders are not copied", order.Type)
+	}
+
+	return &copied, ""
+}
+
+// GetCopyTrades reads the copy trades of the given follower, latest first
+func GetCopyTrades(followerID int) ([]model.CopyTrade, error) {
+	if db == nil {
+		return nil, fmt.Errorf("no connection is created to the database")
+	}
+
+	var results []model.CopyTrade
+	if err := db.Select(&results, "SELECT * FROM copy_trades WHERE follower_id = $1 ORDER BY id DESC", followerID); err != nil {
+		return nil, fmt.Errorf("error reading copy trades: %q", err)
+	}
+
+	return results, nil
+}
+
+func deleteFollowersBySignalID(signalID int, tx *sqlx.Tx) error {
+	if tx == nil {
+		return fmt.Errorf("given transaction is nil")
+	}
+
+	_, err := tx.Exec("DELETE FROM followers WHERE leader_id = $1 OR signal_id = $1", signalID)
+	if err != nil {
+		return fmt.Errorf("failed to delete followers from store : %s", err)
+	}
+
+	return nil
+}
@@ -53,6 +53,34 @@ func getHolding(signalID int, code string) (model.Holding, error) {
 	return result, nil
 }
 
+// getHoldingsBySignalIDs reads the holdings of all the given signals in a single query and maps them by signal id
+func getHoldingsBySignalIDs(signalIDs []int) (map[int][]model.Holding, error) {
+	if db == nil {
+		return nil, fmt.Errorf("no connection is created to the database")
+	}
+
+	results := make(map[int][]model.Holding)
+	if len(signalIDs) == 0 {
+		return results, nil
+	}
+
+	query, args, err := sqlx.In("SELECT * FROM holdings WHERE signal_id IN (?)", signalIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build holdings query : %s", err)
+	}
+
+	var holdings []model.Holding
+	if err = db.Select(&holdings, db.Rebind(query), args...); err != nil {
+		return nil, fmt.Errorf("error reading holdings: %q", err)
+	}
+
+	for _, holding := range holdings {
+		results[holding.SignalID] = append(results[holding.SignalID], holding)
+	}
+
+	return results, nil
+}
+
 func deleteHoldingsBySignalID(signal_id int, tx *sqlx.Tx) error {
 	if tx == nil {
 		return fmt.Errorf("given transaction is nil")
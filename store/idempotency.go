@@ -0,0 +1,95 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/heroku/stocksignals/model"
+)
+
+// ClaimIdempotencyKey saves the given key of the given user as in progress for the request
+// with the given hash until lockedUntil, and kept until the given expiry time. It returns nil
+// when the key is claimed, or the unexpired key saved by a previous request. An expired key,
+// or a key still in progress after its lock, is claimed again.
+func ClaimIdempotencyKey(userID int, key, requestHash string, now, lockedUntil, expires int64) (*model.IdempotencyKey, error) {
+	if db == nil {
+		return nil, fmt.Errorf("no connection is created to the database")
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin idempotency key claim : %s", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM idempotency_keys WHERE user_id = $1 AND idempotency_key = $2"+
+		" AND (expires_time <= $3 OR (status = 0 AND locked_until <= $3))", userID, key, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete expired idempotency key : %s", err)
+	}
+
+	result, err := tx.Exec("INSERT INTO idempotency_keys (user_id, idempotency_key, request_hash, created_time, expires_time, locked_until)"+
+		" VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (user_id, idempotency_key) DO NOTHING", userID, key, requestHash, now, expires, lockedUntil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert idempotency key : %s", err)
+	}
+
+	var existing *model.IdempotencyKey
+	if inserted, err := result.RowsAffected(); err != nil {
+		return nil, fmt.Errorf("failed to insert idempotency key : %s", err)
+	} else if inserted == 0 {
+		existing = &model.IdempotencyKey{}
+		err = tx.Get(existing, "SELECT * FROM idempotency_keys WHERE user_id = $1 AND idempotency_key = $2", userID, key)
+		if err != nil {
+			return nil, fmt.Errorf("error reading idempotency key: %q", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to complete idempotency key claim : %s", err)
+	}
+
+	return existing, nil
+}
+
+// SaveIdempotentResponse saves the response of the request of the given claimed key, to replay it on retries
+func SaveIdempotentResponse(userID int, key string, status int, contentType string, response []byte) error {
+	if db == nil {
+		return fmt.Errorf("no connection is created to the database")
+	}
+
+	_, err := db.Exec("UPDATE idempotency_keys SET status = $1, content_type = $2, response = $3"+
+		" WHERE user_id = $4 AND idempotency_key = $5 AND status = 0", status, contentType, string(response), userID, key)
+	if err != nil {
+		return fmt.Errorf("failed to save idempotent response : %s", err)
+	}
+
+	return nil
+}
+
+// ReleaseIdempotencyKey deletes the given claimed key, so that the request can be retried
+func ReleaseIdempotencyKey(userID int, key string) error {
+	if db == nil {
+		return fmt.Errorf("no connection is created to the database")
+	}
+
+	if _, err := db.Exec("DELETE FROM idempotency_keys WHERE user_id = $1 AND idempotency_key = $2 AND status = 0", userID, key); err != nil {
+		return fmt.Errorf("failed to release idempotency key : %s", err)
+	}
+
+	return nil
+}
+
+// DeleteExpiredIdempotencyKeys deletes the keys expired at the given time and returns their number
+func DeleteExpiredIdempotencyKeys(now time.Time) (int64, error) {
+	if db == nil {
+		return 0, fmt.Errorf("no connection is created to the database")
+	}
+
+	result, err := db.Exec("DELETE FROM idempotency_keys WHERE expires_time <= $1", now.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired idempotency keys : %s", err)
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,200 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/heroku/stocksignals/model"
+	"github.com/jmoiron/sqlx"
+)
+
+// GetBillableSubscriptions reads the subscriptions which are active at some
+// point after the given time, with the price of their signals.
+func GetBillableSubscriptions(since int64) ([]model.BillableSubscription, error) {
+	if db == nil {
+		return nil, fmt.Errorf("no connection is created to the database")
+	}
+
+	var results []model.BillableSubscription
+	err := db.Select(&results, "SELECT subscriptions.*, signals.price FROM subscriptions "+
+		"JOIN signals ON signals.id = subscriptions.signal_id "+
+		"WHERE subscriptions.status = $1 OR subscriptions.end_time >= $2", model.ACTIVE, since)
+	if err != nil {
+		return nil, fmt.Errorf("error reading billable subscriptions: %q", err)
+	}
+
+	return results, nil
+}
+
+// SaveInvoice inserts the invoice of a subscription for a period. If the
+// invoice already exists and is neither paid nor being paid, its amount is updated
+// instead, so that a cancellation prorates the invoice of its period.
+func SaveInvoice(invoice model.Invoice) error {
+	if db == nil {
+		return fmt.Errorf("no connection is created to the database")
+	}
+
+	invoice.Status = model.UNPAID
+	_, err := db.NamedExec("INSERT INTO invoices "+
+		"(subscription_id, user_id, signal_id, period_start, period_end, amount, status, due_time) "+
+		"VALUES (:subscription_id, :user_id, :signal_id, :period_start, :period_end, :amount, :status, :due_time) "+
+		"ON CONFLICT (subscription_id, period_start) DO UPDATE SET amount = EXCLUDED.amount "+
+		"WHERE invoices.status NOT IN ('paid', 'pending')", &invoice)
+	if err != nil {
+		return fmt.Errorf("failed to save invoice of subscription %d : %s", invoice.SubscriptionID, err)
+	}
+
+	return nil
+}
+
+// MarkOverdueInvoices marks the unpaid invoices which are due before the given time as overdue.
+func MarkOverdueInvoices(now int64) error {
+	if db == nil {
+		return fmt.Errorf("no connection is created to the database")
+	}
+
+	_, err := db.Exec("UPDATE invoices SET status = $1 WHERE status = $2 AND due_time < $3", model.OVERDUE, model.UNPAID, now)
+	if err != nil {
+		return fmt.Errorf("failed to mark overdue invoices : %s", err)
+	}
+
+	return nil
+}
+
+// GetInvoicesByUserID reads the invoices of the given user, newest first.
+func GetInvoicesByUserID(userID int) ([]model.Invoice, error) {
+	if db == nil {
+		return nil, fmt.Errorf("no connection is created to the database")
+	}
+
+	results := []model.Invoice{}
+	err := db.Select(&results, "SELECT * FROM invoices WHERE user_id = $1 ORDER BY (period_start, id) DESC", userID)
+	if err != nil {
+		return nil, fmt.Errorf("error reading invoices: %q", err)
+	}
+
+	return results, nil
+}
+
+// GetInvoiceByID reads the invoice with the given id
+func GetInvoiceByID(id int) (*model.Invoice, error) {
+	if db == nil {
+		return nil, fmt.Errorf("no connection is created to the database")
+	}
+
+	var result model.Invoice
+	err := db.Get(&result, "SELECT * FROM invoices WHERE id = $1", id)
+	if err == sql.ErrNoRows {
+		return nil, NotFound("invoice with id %d does not exist.", id)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading invoice with id %d: %q", id, err)
+	}
+
+	return &result, nil
+}
+
+// ClaimInvoice moves the given unpaid or overdue invoice of the given user to pending, so that
+// a single payment can charge it. It returns the pending invoice.
+func ClaimInvoice(id, userID int) (*model.Invoice, error) {
+	if db == nil {
+		return nil, fmt.Errorf("no connection is created to the database")
+	}
+
+	var result model.Invoice
+	err := db.Get(&result, "UPDATE invoices SET status = $1 WHERE id = $2 AND user_id = $3 AND status IN ($4, $5) RETURNING *",
+		model.PENDING, id, userID, model.UNPAID, model.OVERDUE)
+	if err == nil {
+		return &result, nil
+	}
+
+	if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to claim invoice %d : %s", id, err)
+	}
+
+	invoice, err := GetInvoiceByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case invoice.UserID != userID:
+		return nil, NotFound("invoice with id %d does not exist.", id)
+	case invoice.Status == model.PENDING:
+		return nil, Conflict("invoice %d is already being paid", id)
+	default:
+		return nil, Conflict("invoice %d is already paid", id)
+	}
+}
+
+// ReleaseInvoice moves the given pending invoice back to unpaid, or overdue if it is past its due time at the given time.
+func ReleaseInvoice(id int, now int64) error {
+	if db == nil {
+		return fmt.Errorf("no connection is created to the database")
+	}
+
+	_, err := db.Exec("UPDATE invoices SET status = CASE WHEN due_time < $1 THEN $2 ELSE $3 END WHERE id = $4 AND status = $5",
+		now, model.OVERDUE, model.UNPAID, id, model.PENDING)
+	if err != nil {
+		return fmt.Errorf("failed to release invoice %d : %s", id, err)
+	}
+
+	return nil
+}
+
+// MarkInvoicePaid marks the given pending invoice as paid with the payment reference of the gateway.
+func MarkInvoicePaid(id int, reference string) error {
+	if db == nil {
+		return fmt.Errorf("no connection is created to the database")
+	}
+
+	result, err := db.Exec("UPDATE invoices SET status = $1, paid_time = $2, payment_reference = $3 WHERE id = $4 AND status = $5",
+		model.PAID, time.Now().Unix(), reference, id, model.PENDING)
+	if err != nil {
+		return fmt.Errorf("failed to mark invoice %d as paid : %s", id, err)
+	}
+
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return Conflict("invoice %d is not being paid", id)
+	}
+
+	return nil
+}
+
+// GetRevenue sums the invoices of the signals owned by the given user for the
+// periods starting in [from, to), grouped by signal.
+func GetRevenue(ownerID int, from, to int64) ([]model.Revenue, error) {
+	if db == nil {
+		return nil, fmt.Errorf("no connection is created to the database")
+	}
+
+	results := []model.Revenue{}
+	err := db.Select(&results, "SELECT invoices.signal_id, count(*) AS num_invoices, "+
+		"COALESCE(sum(amount) FILTER (WHERE invoices.status = 'paid'), 0) AS paid, "+
+		"COALESCE(sum(amount) FILTER (WHERE invoices.status = 'unpaid'), 0) AS unpaid, "+
+		"COALESCE(sum(amount) FILTER (WHERE invoices.status = 'overdue'), 0) AS overdue, "+
+		"COALESCE(sum(amount) FILTER (WHERE invoices.status = 'pending'), 0) AS pending "+
+		"FROM invoices JOIN signals ON signals.id = invoices.signal_id "+
+		"WHERE signals.owner_id = $1 AND invoices.period_start >= $2 AND invoices.period_start < $3 "+
+		"GROUP BY invoices.signal_id ORDER BY invoices.signal_id", ownerID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("error reading revenue: %q", err)
+	}
+
+	return results, nil
+}
+
+func deleteInvoicesBySignalID(signalID int, tx *sqlx.Tx) error {
+	if tx == nil {
+		return fmt.Errorf("given transaction is nil")
+	}
+
+	_, err := tx.Exec(fmt.Sprintf("DELETE FROM invoices WHERE signal_id = %d", signalID))
+	if err != nil {
+		return fmt.Errorf("failed to delete invoices from store : %s", err)
+	}
+
+	return nil
+}
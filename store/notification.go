@@ -0,0 +1,112 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/heroku/stocksignals/model"
+)
+
+// RegisterNotificationChannel registers the given notification channel of a user
+func RegisterNotificationChannel(channel model.NotificationChannel) (*model.NotificationChannel, error) {
+	if db == nil {
+		return nil, fmt.Errorf("no connection is created to the database")
+	}
+
+	switch channel.Kind {
+	case model.EMAIL, model.WEBHOOK:
+	default:
+		return nil, Invalid("kind", "unknown notification channel kind %s", channel.Kind)
+	}
+
+	if channel.Target == "" {
+		return nil, Invalid("target", "notification channel target cannot be empty")
+	}
+
+	err := db.QueryRow("INSERT INTO notification_channels (user_id, kind, target) VALUES ($1, $2, $3) returning id",
+		channel.UserID, channel.Kind, channel.Target).Scan(&channel.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert notification channel : %s", err)
+	}
+
+	return &channel, nil
+}
+
+// GetNotificationChannelsByUserID reads the notification channels of the given user
+func GetNotificationChannelsByUserID(userID int) ([]model.NotificationChannel, error) {
+	if db == nil {
+		return nil, fmt.Errorf("no connection is created to the database")
+	}
+
+	results := []model.NotificationChannel{}
+	if err := db.Select(&results, "SELECT * FROM notification_channels WHERE user_id = $1 ORDER BY id", userID); err != nil {
+		return nil, fmt.Errorf("error reading notification channels: %q", err)
+	}
+
+	return results, nil
+}
+
+// DeleteNotificationChannel deletes the given notification channel of the given user
+func DeleteNotificationChannel(id, userID int) error {
+	if db == nil {
+		return fmt.Errorf("no connection is created to the database")
+	}
+
+	result, err := db.Exec("DELETE FROM notification_channels WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete notification channel : %s", err)
+	}
+
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return NotFound("notification channel with id %d does not exist.", id)
+	}
+
+	return nil
+}
+
+// GetSubscriberChannels reads the notification channels of the active subscribers of the given signal
+func GetSubscriberChannels(signalID int) ([]model.NotificationChannel, error) {
+	if db == nil {
+		return nil, fmt.Errorf("no connection is created to the database")
+	}
+
+	var results []model.NotificationChannel
+	err := db.Select(&results, "SELECT notification_channels.* FROM notification_channels "+
+		"JOIN subscriptions ON subscriptions.user_id = notification_channels.user_id "+
+		"WHERE subscriptions.signal_id = $1 AND subscriptions.status = $2", signalID, model.ACTIVE)
+	if err != nil {
+		return nil, fmt.Errorf("error reading subscriber notification channels: %q", err)
+	}
+
+	return results, nil
+}
+
+// SaveDelivery logs the given notification delivery
+func SaveDelivery(delivery model.Delivery) error {
+	if db == nil {
+		return fmt.Errorf("no connection is created to the database")
+	}
+
+	_, err := db.NamedExec("INSERT INTO notification_deliveries "+
+		"(channel_id, user_id, signal_id, event_type, status, attempts, last_error, delivery_time) "+
+		"VALUES (:channel_id, :user_id, :signal_id, :event_type, :status, :attempts, :last_error, :delivery_time)", &delivery)
+	if err != nil {
+		return fmt.Errorf("failed to insert notification delivery : %s", err)
+	}
+
+	return nil
+}
+
+// GetDeliveriesByUserID reads the latest notification deliveries of the given user
+func GetDeliveriesByUserID(userID, limit int) ([]model.Delivery, error) {
+	if db == nil {
+		return nil, fmt.Errorf("no connection is created to the database")
+	}
+
+	results := []model.Delivery{}
+	err := db.Select(&results, "SELECT * FROM notification_deliveries WHERE user_id = $1 ORDER BY id DESC LIMIT $2", userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error reading notification deliveries: %q", err)
+	}
+
+	return results, nil
+}
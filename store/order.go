@@ -3,6 +3,8 @@ package store
 import (
 	"database/sql"
 	"fmt"
+	"sort"
+	"time"
 
 	"github.com/heroku/stocksignals/model"
 	"github.com/jmoiron/sqlx"
@@ -32,9 +34,218 @@ func GetOrdersBySignalID(signalID int, field string, descend bool) ([]model.Orde
 	return results, nil
 }
 
-func RegisterOrders(orders []model.Order) error {
+// EachOrder calls fn with each order of the given signal in time order, reading them one
+// at a time so that long histories are not loaded into memory. It stops at the first error of fn.
+func EachOrder(signalID int, fn func(model.Order) error) error {
+	return eachRow("orders", "SELECT * FROM orders WHERE signal_id = $1 ORDER BY order_time, id", []interface{}{signalID},
+		func(rows *sqlx.Rows) error {
+			var order model.Order
+			if err := rows.StructScan(&order); err != nil {
+				return err
+			}
+			return fn(order)
+		})
+}
+
+// OrderFilter selects the orders of a signal. The zero values of the
+// optional fields do not filter: From and To bound the order time inclusively,
+// Type and Code select the orders of a type and a stock.
+type OrderFilter struct {
+	SignalID int
+	From     int64
+	To       int64
+	Type     string
+	Code     string
+}
+
+// ListOrders reads a page of the orders selected by the given filter, ordered based on the given field
+func ListOrders(filter OrderFilter, field string, descend bool, page Page) ([]model.Order, string, error) {
+	field, err := sortField(field, DEFAULT_ORDER_FIELD,
+		"id", "order_time", "type", "code", "num_shares", "price", "profit")
+	if err != nil {
+		return nil, "", err
+	}
+
+	q := listQuery{table: "orders"}
+	q.where("signal_id = ?", filter.SignalID)
+	if filter.From != 0 {
+		q.where("order_time >= ?", filter.From)
+	}
+	if filter.To != 0 {
+		q.where("order_time <= ?", filter.To)
+	}
+	if filter.Type != "" {
+		q.where("type = ?", filter.Type)
+	}
+	if filter.Code != "" {
+		q.where("code = ?", filter.Code)
+	}
+
+	results := []model.Order{}
+	next, err := q.selectPage(&results, field, descend, page)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return results, next, nil
+}
+
+// GetOrdersAfterID reads the orders of the given signal with an id greater than the given one, in id order
+func GetOrdersAfterID(signalID, afterID int) ([]model.Order, error) {
+	if db == nil {
+		return nil, fmt.Errorf("no connection is created to the database")
+	}
+
+	var results []model.Order
+	err := db.Select(&results, "SELECT * FROM orders WHERE signal_id = $1 AND id > $2 ORDER BY id", signalID, afterID)
+	if err != nil {
+		return nil, fmt.Errorf("error reading orders: %q", err)
+	}
+
+	return results, nil
+}
+
+// GetLastOrderID returns the greatest order id of the given signal, or 0 if it has no orders
+func GetLastOrderID(signalID int) (int, error) {
+	if db == nil {
+		return 0, fmt.Errorf("no connection is created to the database")
+	}
+
+	var id int
+	if err := db.Get(&id, "SELECT COALESCE(max(id), 0) FROM orders WHERE signal_id = $1", signalID); err != nil {
+		return 0, fmt.Errorf("error reading last order id: %q", err)
+	}
+
+	return id, nil
+}
+
+// CountTradesSince counts the buy, sell, add and reduce orders of all the given
+// signals made at or after the given time in a single query and maps them by signal id
+func CountTradesSince(signalIDs []int, since int64) (map[int]int, error) {
+	if db == nil {
+		return nil, fmt.Errorf("no connection is created to the database")
+	}
+
+	results := make(map[int]int)
+	if len(signalIDs) == 0 {
+		return results, nil
+	}
+
+	query, args, err := sqlx.In("SELECT signal_id, count(*) FROM orders WHERE signal_id IN (?) AND order_time >= ?"+
+		" AND type NOT IN (?, ?) GROUP BY signal_id", signalIDs, since, model.DEPOSIT, model.WITHDRAW)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build trades query : %s", err)
+	}
+
+	rows, err := db.Query(db.Rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("error counting trades: %q", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var signalID, count int
+		if err = rows.Scan(&signalID, &count); err != nil {
+			return nil, fmt.Errorf("error counting trades: %q", err)
+		}
+		results[signalID] = count
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error counting trades: %q", err)
+	}
+
+	return results, nil
+}
+
+// RegisterOrders executes and inserts the given orders of the given user, updating the holdings and
+// stats of their signals, and queues the current ones to be copied to the followers. It returns the
+// registered orders with their ids.
+func RegisterOrders(orders []model.Order, userID int) ([]model.Order, error) {
+	if db == nil {
+		return nil, fmt.Errorf("no connection is created to the database")
+	}
+
 	tx := db.MustBegin()
+	defer tx.Rollback()
+
+	registered, _, err := executeOrders(orders, userID, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	for _, order := range registered {
+		if order.PastOrder {
+			continue
+		}
+
+		if _, err = tx.Exec("INSERT INTO pending_copies (order_id, queue_time) VALUES ($1, $2)", order.ID, now); err != nil {
+			return nil, fmt.Errorf("failed to queue the copies of order %d : %s", order.ID, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to complete order registration : %s", err)
+	}
+	return registered, nil
+}
+
+// SimulateOrders executes the given orders like RegisterOrders in a transaction which is rolled back.
+// It returns the executed orders, without ids, and the resulting portfolio of each of their signals
+// in signal id order. The stats of a portfolio are the ones computed by its last order, as the stats of
+// the orders in the past are not the latest in time. Nothing is saved, but the ids of the rolled back
+// rows are consumed.
+func SimulateOrders(orders []model.Order, userID int) ([]model.Order, []model.Portfolio, error) {
+	if db == nil {
+		return nil, nil, fmt.Errorf("no connection is created to the database")
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin order simulation : %s", err)
+	}
+	defer tx.Rollback()
+
+	executed, stats, err := executeOrders(orders, userID, tx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i := range executed {
+		executed[i].ID = 0
+	}
+
+	var signalIDs []int
+	seen := make(map[int]bool)
+	for _, order := range executed {
+		if !seen[order.SignalID] {
+			seen[order.SignalID] = true
+			signalIDs = append(signalIDs, order.SignalID)
+		}
+	}
+	sort.Ints(signalIDs)
+
+	var portfolios []model.Portfolio
+	for _, signalID := range signalIDs {
+		portfolio := model.Portfolio{Stats: *stats[signalID]}
+		portfolio.Stats.ID = 0
+
+		portfolio.Holdings = []model.Holding{}
+		err = tx.Select(&portfolio.Holdings, "SELECT * FROM holdings WHERE signal_id = $1 ORDER BY code", signalID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading simulated holdings: %q", err)
+		}
+
+		portfolios = append(portfolios, portfolio)
+	}
+
+	return executed, portfolios, nil
+}
 
+// executeOrders executes and inserts the given orders of the given user in the given transaction.
+// It returns the registered orders and the stats of their signals after their last order.
+func executeOrders(orders []model.Order, userID int, tx *sqlx.Tx) ([]model.Order, map[int]*model.Stats, error) {
 	// Map the orders based on their signal ID
 	signalToOrdersMap := make(map[int][]model.Order)
 	for _, order := range orders {
@@ -45,37 +256,47 @@ func RegisterOrders(orders []model.Order) error {
 		signalToOrdersMap[order.SignalID] = append(signalToOrdersMap[order.SignalID], order)
 	}
 
-	var err error
+	var registered []model.Order
+	statsMap := make(map[int]*model.Stats)
 	for signalID, orders := range signalToOrdersMap {
 		signal, err := GetSignalByID(signalID)
 		if err != nil {
-			return err
+			return nil, nil, err
+		}
+
+		if signal.Archived() {
+			return nil, nil, Conflict("signal %d is archived and cannot register orders", signalID)
 		}
 
 		stats, err := GetLatestStats(signalID)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 
 		holdings, err := GetHoldingsBySignalID(signalID, "", true)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 
 		for _, order := range orders {
-			if err = registerOrder(signal, &order, stats, &holdings, tx); err != nil {
-				return err
+			order.BalanceBefore = getStockBalance(holdings) + stats.Funds
+			if loc := findHolding(order.Code, holdings); loc != -1 {
+				order.SharesBefore = holdings[loc].NumShares
+			}
+
+			if err = registerOrder(signal, &order, stats, &holdings, userID, tx); err != nil {
+				return nil, nil, err
 			}
+			registered = append(registered, order)
 		}
+		statsMap[signalID] = stats
 	}
 
-	if err = tx.Commit(); err != nil {
-		return fmt.Errorf("failed to complete order registration : %s", err)
-	}
-	return nil
+	return registered, statsMap, nil
 }
 
-func registerOrder(signal *model.Signal, order *model.Order, stats *model.Stats, holdings *[]model.Holding, tx *sqlx.Tx) error {
+// registerOrder executes and inserts the given order, recording it in the audit log as made by the given user
+func registerOrder(signal *model.Signal, order *model.Order, stats *model.Stats, holdings *[]model.Holding, userID int, tx *sqlx.Tx) error {
 	if order == nil {
 		return fmt.Errorf("given order is nil")
 	}
@@ -114,22 +335,41 @@ func registerOrder(signal *model.Signal, order *model.Order, stats *model.Stats,
 
 		profit = order.Profit
 	default:
-		err = fmt.Errorf("unknown order type")
+		err = Invalid("type", "unknown order type")
 	}
 
 	if err != nil {
-		return fmt.Errorf("failed to prepare %s order : %s", order.Type, err)
+		return wrap(err, fmt.Sprintf("failed to prepare %s order", order.Type))
 	}
 
-	_, err = tx.NamedExec("INSERT INTO orders (signal_id, order_time, type, code, name, num_shares, price, profit)"+
-		" VALUES (:signal_id, :order_time, :type, :code, :name, :num_shares, :price, :profit)", &order)
+	rows, err := tx.NamedQuery("INSERT INTO orders (signal_id, order_time, type, code, name, num_shares, price, profit)"+
+		" VALUES (:signal_id, :order_time, :type, :code, :name, :num_shares, :price, :profit) RETURNING id", order)
 	if err != nil {
 		return fmt.Errorf("failed to insert order : %s", err)
 	}
 
+	if rows.Next() {
+		err = rows.Scan(&order.ID)
+	}
+	rows.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read inserted order id : %s", err)
+	}
+
+	if err = writeAudit(tx, userID, order.SignalID, model.ORDER_REGISTER, order.ID, order); err != nil {
+		return err
+	}
+
 	stats.Time = order.Time
 
-	if err = insertStats(tx, stats, profit, previousBalance, *holdings, order.PastOrder); err != nil {
+	var prices map[string]float64
+	if !order.PastOrder {
+		if prices, err = getBidPrices(*holdings); err != nil {
+			return err
+		}
+	}
+
+	if err = insertStats(tx, stats, profit, previousBalance, *holdings, prices); err != nil {
 		return err
 	}
 
@@ -157,7 +397,7 @@ func executeWithdrawOrder(stats *model.Stats, order *model.Order) error {
 	}
 
 	if order.Profit > stats.Funds {
-		return fmt.Errorf("available funds are less than withdraw amount")
+		return InsufficientFunds("available funds are less than withdraw amount")
 	}
 
 	stats.Funds -= order.Profit
@@ -177,7 +417,7 @@ func executeBuyOrder(signal model.Signal, stats *model.Stats, order *model.Order
 	}
 
 	if order.Type == model.BUY && ((float64(order.NumShares) * order.Price) > stats.Funds) {
-		return fmt.Errorf("not available funds to buy the order")
+		return InsufficientFunds("not available funds to buy the order")
 	}
 
 	// Add the new holding if it does not exist
@@ -242,11 +482,11 @@ func executeSellOrder(signal model.Signal, stats *model.Stats, order *model.Orde
 	}
 
 	if holding == nil {
-		return fmt.Errorf("%s stock does not exist in the holdings", order.Code)
+		return InsufficientFunds("%s stock does not exist in the holdings", order.Code)
 	}
 
 	if order.NumShares > holding.NumShares {
-		return fmt.Errorf("%d %s stock does not exist in the holdings", order.NumShares, order.Code)
+		return InsufficientFunds("%d %s stock does not exist in the holdings", order.NumShares, order.Code)
 	}
 
 	profit := float64(order.NumShares) * (order.Price - holding.Price)
@@ -337,22 +577,36 @@ func deleteOrdersBySignalID(signal_id int, tx *sqlx.Tx) error {
 	return nil
 }
 
-// DeleteOrdersByID deletes the given orders from the database
+// DeleteOrdersByID deletes the given orders of the given user from the database and records them in the audit log.
 // It cleans up only the orders, so be careful when you are using it
-func DeleteOrdersByID(ids []int) error {
+func DeleteOrdersByID(ids []int, userID int) error {
 	tx := db.MustBegin()
+	defer tx.Rollback()
 
 	var err error
 	for _, id := range ids {
-		_, err = getOrderByID(id)
+		order, err := GetOrderByID(id)
+		if err != nil {
+			return err
+		}
+
+		signal, err := GetSignalByID(order.SignalID)
 		if err != nil {
 			return err
 		}
 
+		if signal.Archived() {
+			return Conflict("signal %d is archived and cannot delete orders", order.SignalID)
+		}
+
 		_, err = tx.Exec(fmt.Sprintf("DELETE FROM orders WHERE id = %d", id))
 		if err != nil {
 			return fmt.Errorf("failed to delete order from store : %s", err)
 		}
+
+		if err = writeAudit(tx, userID, order.SignalID, model.ORDER_DELETE, id, order); err != nil {
+			return err
+		}
 	}
 
 	if err = tx.Commit(); err != nil {
@@ -362,19 +616,19 @@ func DeleteOrdersByID(ids []int) error {
 	return nil
 }
 
-// Reads the order from the database by ID, returns empty ID if it cannot find it
-func getOrderByID(id int) (*model.Order, error) {
+// GetOrderByID reads the order from the database by ID, returns an error if it cannot find it
+func GetOrderByID(id int) (*model.Order, error) {
 	if db == nil {
 		return nil, fmt.Errorf("no connection is created to the database")
 	}
 
 	if id < 0 {
-		return nil, fmt.Errorf("invalid order id")
+		return nil, Invalid("id", "invalid order id")
 	}
 	var result model.Order
-	err := db.Get(&result, fmt.Sprintf("SELECT * FROM order WHERE id=%d", id))
+	err := db.Get(&result, fmt.Sprintf("SELECT * FROM orders WHERE id=%d", id))
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("order with id %d does not exist.", id)
+		return nil, NotFound("order with id %d does not exist.", id)
 	}
 
 	if err != nil {
@@ -0,0 +1,146 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+const (
+	// DEFAULT_PAGE_LIMIT is the number of rows of a page when no limit is given.
+	DEFAULT_PAGE_LIMIT = 50
+
+	// MAX_PAGE_LIMIT is the greatest number of rows of a page.
+	MAX_PAGE_LIMIT = 500
+)
+
+// Page selects a page of a list. Cursor is the position returned with the
+// previous page, empty for the first one. A zero limit reads all the rows.
+type Page struct {
+	Limit  int
+	Cursor string
+}
+
+// cursor is the position of the last row of a page: the value of its sort field and its id.
+// It keeps the sort field and direction of the page, as it is only valid in that order.
+type cursor struct {
+	Field   string `json:"f"`
+	Descend bool   `json:"d,omitempty"`
+	Value   string `json:"v"`
+	ID      int    `json:"id"`
+}
+
+func decodeCursor(str string) (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(str)
+	if err != nil {
+		return nil, Invalid("cursor", "invalid cursor")
+	}
+
+	var c cursor
+	if err = json.Unmarshal(data, &c); err != nil {
+		return nil, Invalid("cursor", "invalid cursor")
+	}
+	return &c, nil
+}
+
+func (c cursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// listQuery builds the keyset paginated queries of the list functions
+type listQuery struct {
+	table      string
+	conditions []string
+	args       []interface{}
+}
+
+// where adds the given condition with its ? placeholders
+func (q *listQuery) where(condition string, args ...interface{}) {
+	q.conditions = append(q.conditions, condition)
+	q.args = append(q.args, args...)
+}
+
+// selectPage reads the page of the rows ordered by the given field, then id, into
+// dest, a pointer to a slice of structs. It returns the cursor of the next page,
+// or an empty string on the last page. The field must be whitelisted by the caller.
+func (q *listQuery) selectPage(dest interface{}, field string, descend bool, page Page) (string, error) {
+	if db == nil {
+		return "", fmt.Errorf("no connection is created to the database")
+	}
+
+	if page.Limit < 0 || page.Limit > MAX_PAGE_LIMIT {
+		return "", Invalid("limit", "limit must be between 0 and %d", MAX_PAGE_LIMIT)
+	}
+
+	order, comparison := "ASC", ">"
+	if descend {
+		order, comparison = "DESC", "<"
+	}
+
+	if page.Cursor != "" {
+		c, err := decodeCursor(page.Cursor)
+		if err != nil {
+			return "", err
+		}
+
+		if c.Field != field || c.Descend != descend {
+			return "", Invalid("cursor", "cursor does not match the sort field %s and order %s", field, strings.ToLower(order))
+		}
+		q.where(fmt.Sprintf("(%s, id) %s (?, ?)", field, comparison), c.Value, c.ID)
+	}
+
+	query := "SELECT * FROM " + q.table
+	if len(q.conditions) > 0 {
+		query += " WHERE " + strings.Join(q.conditions, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY %s %s, id %s", field, order, order)
+
+	// Read one more row to know whether there is a next page
+	args := q.args
+	if page.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, page.Limit+1)
+	}
+
+	if err := db.Select(dest, db.Rebind(query), args...); err != nil {
+		return "", fmt.Errorf("error reading %s: %q", q.table, err)
+	}
+
+	rows := reflect.ValueOf(dest).Elem()
+	if page.Limit == 0 || rows.Len() <= page.Limit {
+		return "", nil
+	}
+
+	rows.SetLen(page.Limit)
+	last := rows.Index(page.Limit - 1)
+	id := int(db.Mapper.FieldByName(last, "id").Int())
+
+	// The nullable fields are pointers, whose rows must be filtered out by the caller when they are null
+	value := db.Mapper.FieldByName(last, field)
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return "", fmt.Errorf("cannot page %s on the null %s of row %d", q.table, field, id)
+		}
+		value = value.Elem()
+	}
+
+	next := cursor{Field: field, Descend: descend, Value: fmt.Sprint(value.Interface()), ID: id}
+	return next.encode(), nil
+}
+
+// sortField returns the given field if it is one of the allowed ones, the default field if it is empty
+func sortField(field, defaultField string, allowed ...string) (string, error) {
+	if field == "" {
+		return defaultField, nil
+	}
+
+	for _, f := range allowed {
+		if f == field {
+			return field, nil
+		}
+	}
+	return "", Invalid("field", "unknown sort field %s", field)
+}
@@ -0,0 +1,231 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/heroku/stocksignals/model"
+	"github.com/lib/pq"
+)
+
+// SearchQuery selects the listed signals matching all the words of Text in their name,
+// description or tags, or holding a stock whose symbol is one of the words, and having
+// all the given tags. Text or Tags can be empty, but not both.
+type SearchQuery struct {
+	Text  string
+	Tags  []string
+	Limit int
+}
+
+// SignalSearch searches the signals, best match first.
+type SignalSearch interface {
+	Search(query SearchQuery) ([]model.Signal, error)
+}
+
+// PostgresSearch searches the signals of the database with Postgres full-text search.
+type PostgresSearch struct{}
+
+// Search runs the given query against the signals_search_idx and holdings_code_idx indexes.
+func (PostgresSearch) Search(query SearchQuery) ([]model.Signal, error) {
+	if db == nil {
+		return nil, fmt.Errorf("no connection is created to the database")
+	}
+
+	query, err := checkSearchQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	q := listQuery{table: "signals"}
+	q.where("NOT is_follower")
+	q.where("archived_time IS NULL")
+	order := "num_subscribers DESC, id"
+	if query.Text != "" {
+		q.where("(signal_search_document(name, description, tags) @@ plainto_tsquery('english', ?)"+
+			" OR EXISTS (SELECT 1 FROM holdings h WHERE upper(h.code) = ANY(?) AND h.signal_id = signals.id AND h.num_shares > 0))",
+			query.Text, pq.Array(searchSymbols(query.Text)))
+		order = "ts_rank(signal_search_document(name, description, tags), plainto_tsquery('english', ?)) DESC, " + order
+	}
+
+	if len(query.Tags) > 0 {
+		q.where("tags @> ?", model.Tags(query.Tags))
+	}
+
+	args := q.args
+	sql := "SELECT * FROM signals WHERE " + strings.Join(q.conditions, " AND ") + " ORDER BY " + order
+	if query.Text != "" {
+		args = append(args, query.Text)
+	}
+
+	if query.Limit > 0 {
+		sql += " LIMIT ?"
+		args = append(args, query.Limit)
+	}
+
+	results := []model.Signal{}
+	if err = db.Select(&results, db.Rebind(sql), args...); err != nil {
+		return nil, fmt.Errorf("error searching signals: %q", err)
+	}
+
+	return results, nil
+}
+
+// MemorySearch searches an in-memory list of signals, for the tests and the development
+// without a database. Unlike PostgresSearch it does not stem the words, so they only
+// match whole words of the signals.
+type MemorySearch struct {
+	mutex   sync.RWMutex
+	signals []model.Signal
+	symbols map[int][]string
+}
+
+// NewMemorySearch returns an empty MemorySearch.
+func NewMemorySearch() *MemorySearch {
+	return &MemorySearch{symbols: make(map[int][]string)}
+}
+
+// Put adds the given signal, or replaces the one with its id, with the symbols of the stocks it holds.
+func (s *MemorySearch) Put(signal model.Signal, symbols ...string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i := range s.signals {
+		if s.signals[i].ID == signal.ID {
+			s.signals = append(s.signals[:i], s.signals[i+1:]...)
+			break
+		}
+	}
+	s.signals = append(s.signals, signal)
+
+	s.symbols[signal.ID] = nil
+	for _, symbol := range symbols {
+		s.symbols[signal.ID] = append(s.symbols[signal.ID], strings.ToUpper(symbol))
+	}
+}
+
+// Search runs the given query against the signals put in the search, ranked by the
+// number of occurrences of the words in their name, description and tags.
+func (s *MemorySearch) Search(query SearchQuery) ([]model.Signal, error) {
+	query, err := checkSearchQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	words := searchWords(query.Text)
+	symbols := searchSymbols(query.Text)
+	ranks := make(map[int]int)
+	results := []model.Signal{}
+	for _, signal := range s.signals {
+		if signal.Follower || signal.Archived() || !hasTags(signal.Tags, query.Tags) {
+			continue
+		}
+
+		document := searchWords(signal.Name + " " + signal.Description + " " + strings.Join(signal.Tags, " "))
+		matched, rank := true, 0
+		for _, word := range words {
+			count := 0
+			for _, w := range document {
+				if w == word {
+					count++
+				}
+			}
+
+			matched = matched && count > 0
+			rank += count
+		}
+
+		if !matched && !holdsAny(s.symbols[signal.ID], symbols) {
+			continue
+		}
+
+		if !matched {
+			rank = 0
+		}
+		ranks[signal.ID] = rank
+		results = append(results, signal)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if ranks[a.ID] != ranks[b.ID] {
+			return ranks[a.ID] > ranks[b.ID]
+		}
+		if a.NumSubscribers != b.NumSubscribers {
+			return a.NumSubscribers > b.NumSubscribers
+		}
+		return a.ID < b.ID
+	})
+
+	if query.Limit > 0 && len(results) > query.Limit {
+		results = results[:query.Limit]
+	}
+	return results, nil
+}
+
+// checkSearchQuery checks the given query and returns it with its text trimmed and its tags normalized
+func checkSearchQuery(query SearchQuery) (SearchQuery, error) {
+	query.Text = strings.TrimSpace(query.Text)
+	if len(query.Tags) > 0 {
+		query.Tags = model.Tags(query.Tags).Normalize()
+	}
+
+	if query.Text == "" && len(query.Tags) == 0 {
+		return query, Invalid("q", "a search text or tags must be given")
+	}
+
+	if query.Limit < 0 || query.Limit > MAX_PAGE_LIMIT {
+		return query, Invalid("limit", "limit must be between 0 and %d", MAX_PAGE_LIMIT)
+	}
+	return query, nil
+}
+
+// searchWords splits the given text into its lowercased words
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// searchSymbols returns the words of the given text which can be stock symbols, uppercased
+func searchSymbols(text string) []string {
+	symbols := []string{}
+	for _, word := range strings.Fields(text) {
+		symbols = append(symbols, strings.ToUpper(strings.Trim(word, ",;")))
+	}
+	return symbols
+}
+
+func hasTags(tags model.Tags, wanted []string) bool {
+	normalized := tags.Normalize()
+	for _, tag := range wanted {
+		found := false
+		for _, t := range normalized {
+			if t == tag {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func holdsAny(held, symbols []string) bool {
+	for _, h := range held {
+		for _, symbol := range symbols {
+			if h == symbol {
+				return true
+			}
+		}
+	}
+	return false
+}
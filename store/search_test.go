@@ -0,0 +1,111 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/heroku/stocksignals/model"
+)
+
+func newTestSearch() *MemorySearch {
+	archived := int64(1500000000)
+	s := NewMemorySearch()
+	s.Put(model.Signal{ID: 1, Name: "Tech Momentum", Description: "Momentum trades on large tech stocks like INTC", Tags: model.Tags{"sector:technology", "style:momentum"}, NumSubscribers: 5}, "AAPL", "msft")
+	s.Put(model.Signal{ID: 2, Name: "Dividend Income", Description: "Steady dividend payers", Tags: model.Tags{"sector:utilities", "risk:low"}, NumSubscribers: 20}, "DUK")
+	s.Put(model.Signal{ID: 3, Name: "Tech Value", Description: "Undervalued tech", Tags: model.Tags{"Sector: Technology", "risk:medium"}, NumSubscribers: 20}, "INTC")
+	s.Put(model.Signal{ID: 4, Name: "Tech Swing", Description: "Swing trades on tech", Tags: model.Tags{"sector:technology"}, NumSubscribers: 20}, "AAPL")
+	s.Put(model.Signal{ID: 5, Name: "Tech Follower", Follower: true}, "AAPL")
+	s.Put(model.Signal{ID: 6, Name: "Tech Archive", ArchivedTime: &archived}, "AAPL")
+	return s
+}
+
+func TestMemorySearch(t *testing.T) {
+	tests := []struct {
+		name  string
+		query SearchQuery
+		want  []int
+	}{
+		{"words rank by occurrences, then subscribers, then id", SearchQuery{Text: "tech"}, []int{3, 4, 1}},
+		{"all the words must match", SearchQuery{Text: "tech swing"}, []int{4}},
+		{"words match the description", SearchQuery{Text: "dividend"}, []int{2}},
+		{"words match the tags", SearchQuery{Text: "utilities"}, []int{2}},
+		{"words are case insensitive", SearchQuery{Text: "  MOMENTUM "}, []int{1}},
+		{"no match", SearchQuery{Text: "crypto"}, []int{}},
+		{"held symbols match", SearchQuery{Text: "aapl"}, []int{4, 1}},
+		{"held symbols are uppercased on put", SearchQuery{Text: "MSFT"}, []int{1}},
+		{"word matches rank above held symbols", SearchQuery{Text: "intc"}, []int{1, 3}},
+		{"tags filter without text", SearchQuery{Tags: []string{"sector:technology"}}, []int{3, 4, 1}},
+		{"tags are normalized", SearchQuery{Tags: []string{" SECTOR : technology", "risk:medium"}}, []int{3}},
+		{"tags filter the words", SearchQuery{Text: "tech", Tags: []string{"style:momentum"}}, []int{1}},
+		{"limit", SearchQuery{Text: "tech", Limit: 2}, []int{3, 4}},
+	}
+
+	s := newTestSearch()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results, err := s.Search(test.query)
+			if err != nil {
+				t.Fatalf("Search(%+v) returned error %v", test.query, err)
+			}
+
+			ids := []int{}
+			for _, signal := range results {
+				ids = append(ids, signal.ID)
+			}
+			if !reflect.DeepEqual(ids, test.want) {
+				t.Errorf("Search(%+v) = %v, want %v", test.query, ids, test.want)
+			}
+		})
+	}
+}
+
+func TestMemorySearchPutReplaces(t *testing.T) {
+	s := newTestSearch()
+	s.Put(model.Signal{ID: 2, Name: "Dividend Growth", NumSubscribers: 20})
+
+	results, err := s.Search(SearchQuery{Text: "DUK"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 0 {
+		t.Errorf("Search(DUK) = %v after the symbols were replaced, want none", results)
+	}
+
+	results, err = s.Search(SearchQuery{Text: "growth"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].ID != 2 {
+		t.Errorf("Search(growth) = %v, want the replaced signal 2", results)
+	}
+}
+
+func TestMemorySearchInvalid(t *testing.T) {
+	tests := []struct {
+		query SearchQuery
+		field string
+	}{
+		{SearchQuery{Text: "  "}, "q"},
+		{SearchQuery{Text: "tech", Limit: -1}, "limit"},
+		{SearchQuery{Text: "tech", Limit: MAX_PAGE_LIMIT + 1}, "limit"},
+	}
+
+	s := newTestSearch()
+	for _, test := range tests {
+		_, err := s.Search(test.query)
+		e, ok := err.(*Error)
+		if !ok || e.Code != VALIDATION || e.Fields[test.field] == "" {
+			t.Errorf("Search(%+v) returned error %v, want an invalid %s", test.query, err, test.field)
+		}
+	}
+}
+
+func TestSearchWordsAndSymbols(t *testing.T) {
+	if got, want := searchWords("Large-cap TECH, 2024!"), []string{"large", "cap", "tech", "2024"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("searchWords() = %v, want %v", got, want)
+	}
+
+	if got, want := searchSymbols("aapl, msft;brk.b"), []string{"AAPL", "MSFT;BRK.B"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("searchSymbols() = %v, want %v", got, want)
+	}
+}
@@ -3,6 +3,7 @@ package store
 import (
 	"database/sql"
 	"fmt"
+	"reflect"
 	"strings"
 
 	"github.com/heroku/stocksignals/model"
@@ -10,7 +11,8 @@ import (
 	"github.com/jmoiron/sqlx"
 )
 
-// Reads the signals from the database and orders them based on the given field
+// Reads the signals from the database and orders them based on the given field.
+// The private signals of the copy-trading followers are not listed.
 func GetSignals(field string, descend bool) ([]model.Signal, error) {
 	if db == nil {
 		return nil, fmt.Errorf("no connection is created to the database")
@@ -26,7 +28,7 @@ func GetSignals(field string, descend bool) ([]model.Signal, error) {
 	}
 
 	var results []model.Signal
-	err := db.Select(&results, fmt.Sprintf("SELECT * FROM signals ORDER BY %s %s", field, order))
+	err := db.Select(&results, fmt.Sprintf("SELECT * FROM signals WHERE NOT is_follower AND archived_time IS NULL ORDER BY %s %s", field, order))
 	if err != nil {
 		return nil, fmt.Errorf("error reading signals: %q", err)
 	}
@@ -34,8 +36,44 @@ func GetSignals(field string, descend bool) ([]model.Signal, error) {
 	return results, nil
 }
 
-// RegisterSignals registers the given signals to the database
-func RegisterSignals(signals []model.Signal) error {
+// ListSignals reads a page of the signals ordered based on the given field.
+// The archived signals and the private signals of the copy-trading followers are not listed.
+func ListSignals(field string, descend bool, page Page) ([]model.Signal, string, error) {
+	field, err := sortField(field, DEFAULT_SIGNAL_FIELD,
+		"id", "name", "price", "num_subscribers", "num_trades", "first_trade_time", "last_trade_time")
+	if err != nil {
+		return nil, "", err
+	}
+
+	q := listQuery{table: "signals"}
+	q.where("NOT is_follower")
+	q.where("archived_time IS NULL")
+
+	results := []model.Signal{}
+	next, err := q.selectPage(&results, field, descend, page)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return results, next, nil
+}
+
+// GetAllSignals reads all the signals which are not archived, including the private signals of the copy-trading followers
+func GetAllSignals() ([]model.Signal, error) {
+	if db == nil {
+		return nil, fmt.Errorf("no connection is created to the database")
+	}
+
+	var results []model.Signal
+	if err := db.Select(&results, "SELECT * FROM signals WHERE archived_time IS NULL ORDER BY id"); err != nil {
+		return nil, fmt.Errorf("error reading signals: %q", err)
+	}
+
+	return results, nil
+}
+
+// RegisterSignals registers the given signals to the database as owned by the given user
+func RegisterSignals(signals []model.Signal, ownerID int) error {
 	if db == nil {
 		return fmt.Errorf("no connection is created to the database")
 	}
@@ -43,6 +81,9 @@ func RegisterSignals(signals []model.Signal) error {
 	tx := db.MustBegin()
 
 	for _, signal := range signals {
+		// The number of subscribers is maintained from the subscriptions
+		signal.NumSubscribers = 0
+		signal.OwnerID = &ownerID
 		if err := registerSignal(signal, tx); err != nil {
 			return err
 		}
@@ -61,12 +102,12 @@ func GetSignalByID(id int) (*model.Signal, error) {
 	}
 
 	if id < 0 {
-		return nil, fmt.Errorf("invalid signal id")
+		return nil, Invalid("id", "invalid signal id")
 	}
 	var result model.Signal
 	err := db.Get(&result, fmt.Sprintf("SELECT * FROM signals WHERE id=%d", id))
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("signal with id %d does not exist.", id)
+		return nil, NotFound("signal with id %d does not exist.", id)
 	}
 
 	if err != nil {
@@ -76,38 +117,127 @@ func GetSignalByID(id int) (*model.Signal, error) {
 	return &result, nil
 }
 
-// DeleteSignalsByID deletes the given signals from the database
-// It cleans up all the orders, stats and holding for this signal.
-func DeleteSignalsByID(ids []int) error {
-	tx := db.MustBegin()
+// UpdateSignal applies the given metadata update of the given user to the signal, if the signal
+// is still at the given version. It increments the version and records the changes in the audit log.
+func UpdateSignal(id, version int, update model.SignalUpdate, userID int) (*model.Signal, error) {
+	if db == nil {
+		return nil, fmt.Errorf("no connection is created to the database")
+	}
 
-	var err error
-	for _, id := range ids {
-		_, err = GetSignalByID(id)
-		if err != nil {
-			return err
-		}
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin signal update : %s", err)
+	}
+	defer tx.Rollback()
 
-		if err = deleteOrdersBySignalID(id, tx); err != nil {
-			return err
+	signal, err := lockSignal(id, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	if signal.Archived() {
+		return nil, Conflict("signal %d is archived", id)
+	}
+
+	if signal.Version != version {
+		return nil, &Error{Code: VERSION_MISMATCH,
+			Message: fmt.Sprintf("signal %d is at version %d, not %d", id, signal.Version, version)}
+	}
+
+	changes := make(map[string]model.Change)
+	if update.Name != nil && *update.Name != signal.Name {
+		if strings.TrimSpace(*update.Name) == "" {
+			return nil, Invalid("name", "signal name cannot be empty")
 		}
+		changes["name"] = model.Change{Old: signal.Name, New: *update.Name}
+		signal.Name = *update.Name
+	}
 
-		if err = deleteStatsBySignalID(id, tx); err != nil {
-			return err
+	if update.Description != nil && *update.Description != signal.Description {
+		changes["description"] = model.Change{Old: signal.Description, New: *update.Description}
+		signal.Description = *update.Description
+	}
+
+	if update.Tags != nil {
+		old, tags := signal.Tags.Normalize(), update.Tags.Normalize()
+		if !reflect.DeepEqual(old, tags) {
+			changes["tags"] = model.Change{Old: old, New: tags}
+			signal.Tags = tags
 		}
+	}
 
-		if err = deleteHoldingsBySignalID(id, tx); err != nil {
-			return err
+	if update.Price != nil && *update.Price != signal.Price {
+		if signal.Follower {
+			return nil, Invalid("price", "follower portfolios have no price")
 		}
 
-		_, err = tx.Exec(fmt.Sprintf("DELETE FROM signals WHERE id = %d", id))
-		if err != nil {
-			return fmt.Errorf("failed to delete signal from store : %s", err)
+		if *update.Price <= 0 {
+			return nil, Invalid("price", "price cannot be less than or equal to 0")
 		}
+		changes["price"] = model.Change{Old: signal.Price, New: *update.Price}
+		signal.Price = *update.Price
+	}
+
+	if len(changes) == 0 {
+		return signal, nil
+	}
+
+	signal.Version++
+	_, err = tx.NamedExec("UPDATE signals SET name = :name, description = :description, tags = :tags, price = :price, "+
+		"version = :version WHERE id = :id", signal)
+	if err != nil {
+		return nil, wrapDB(err, "failed to update signal")
+	}
+
+	if err = writeAudit(tx, userID, id, model.SIGNAL_UPDATE, id, changes); err != nil {
+		return nil, err
 	}
 
 	if err = tx.Commit(); err != nil {
-		return fmt.Errorf("failed to complete signal deletion : %s", err)
+		return nil, fmt.Errorf("failed to complete signal update : %s", err)
+	}
+
+	return signal, nil
+}
+
+// deleteSignal deletes the given signal from the database.
+// It cleans up all the orders, stats, holdings, followers, webhooks, invoices and subscriptions for this signal.
+func deleteSignal(id int, tx *sqlx.Tx) error {
+	if tx == nil {
+		return fmt.Errorf("given transaction is nil")
+	}
+
+	if err := deleteOrdersBySignalID(id, tx); err != nil {
+		return err
+	}
+
+	if err := deleteStatsBySignalID(id, tx); err != nil {
+		return err
+	}
+
+	if err := deleteHoldingsBySignalID(id, tx); err != nil {
+		return err
+	}
+
+	if err := deleteFollowersBySignalID(id, tx); err != nil {
+		return err
+	}
+
+	if err := deleteWebhooksBySignalID(id, tx); err != nil {
+		return err
+	}
+
+	if err := deleteInvoicesBySignalID(id, tx); err != nil {
+		return err
+	}
+
+	if err := deleteSubscriptionsBySignalID(id, tx); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(fmt.Sprintf("DELETE FROM signals WHERE id = %d", id))
+	if err != nil {
+		return fmt.Errorf("failed to delete signal from store : %s", err)
 	}
 
 	return nil
@@ -119,21 +249,21 @@ func registerSignal(signal model.Signal, tx *sqlx.Tx) error {
 	}
 
 	if signal.Name == "" {
-		return fmt.Errorf("signal name cannot be empty")
+		return Invalid("name", "signal name cannot be empty")
 	}
 
 	tempName := strings.TrimSpace(strings.ToLower(signal.Name))
 	if signal.Price <= 0 {
-		return fmt.Errorf("price cannot be less than or equal to 0")
+		return Invalid("price", "price cannot be less than or equal to 0")
 	}
 
 	var result model.Signal
 	err := tx.Get(&result, fmt.Sprintf("SELECT * FROM signals WHERE lower(name)='%s'", tempName))
 	if err == sql.ErrNoRows {
 		var id int
-		errRegister := tx.QueryRow("INSERT INTO signals (name, description, num_subscribers, price, num_trades, "+
-			"first_trade_time, last_trade_time) VALUES ($1, $2, $3, $4, $5, $6, $7) returning id",
-			signal.Name, signal.Description, signal.NumSubscribers, signal.Price, signal.NumTrades, signal.FirstTradeTime, signal.LastTradeTime).Scan(&id)
+		errRegister := tx.QueryRow("INSERT INTO signals (owner_id, name, description, tags, num_subscribers, price, num_trades, "+
+			"first_trade_time, last_trade_time) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id",
+			signal.OwnerID, signal.Name, signal.Description, signal.Tags.Normalize(), signal.NumSubscribers, signal.Price, signal.NumTrades, signal.FirstTradeTime, signal.LastTradeTime).Scan(&id)
 		if errRegister != nil {
 			return fmt.Errorf("error registering signal with name %s: %q", signal.Name, err)
 		}
@@ -149,5 +279,5 @@ func registerSignal(signal model.Signal, tx *sqlx.Tx) error {
 		return fmt.Errorf("error reading signal with name %s: %q", signal.Name, err)
 	}
 
-	return fmt.Errorf("signal already exists with name %s", signal.Name)
+	return Conflict("signal already exists with name %s", signal.Name)
 }
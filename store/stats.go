@@ -2,7 +2,10 @@ package store
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/heroku/stocksignals/model"
@@ -25,7 +28,9 @@ func createNewStats(tx *sqlx.Tx, signalID int) error {
 	return nil
 }
 
-func insertStats(tx *sqlx.Tx, stats *model.Stats, profit, previousBalance float64, holdings []model.Holding, pastStats bool) error {
+// insertStats updates the given stats with the holdings and inserts them. The
+// holdings are valued with the given prices, or with their cost when prices is nil.
+func insertStats(tx *sqlx.Tx, stats *model.Stats, profit, previousBalance float64, holdings []model.Holding, prices map[string]float64) error {
 	if tx == nil {
 		return fmt.Errorf("given transaction is nil")
 	}
@@ -34,7 +39,7 @@ func insertStats(tx *sqlx.Tx, stats *model.Stats, profit, previousBalance float6
 		return fmt.Errorf("stats cannot have signal ID 0")
 	}
 
-	if err := updateStats(stats, profit, previousBalance, holdings, pastStats); err != nil {
+	if err := updateStats(stats, profit, previousBalance, holdings, prices); err != nil {
 		return fmt.Errorf("failed to update stats : %s", err)
 	}
 
@@ -89,34 +94,120 @@ func GetAllStats(signalID int) ([]model.Stats, error) {
 	return results, nil
 }
 
-func updateStats(stats *model.Stats, profit, previousBalance float64, holdings []model.Holding, pastStats bool) error {
-	var stocks []string
-	var totalStockBalance, totalStockEquity float64
-	if len(holdings) > 0 {
-		for _, holding := range holdings {
-			stocks = append(stocks, holding.Code)
-		}
-
-		var prices []float64
-		var err error
-
-		if !pastStats {
-			prices, err = stockapi.GetBidPrices(stocks)
-			if err != nil {
+// EachStats calls fn with each stats of the given signal in time order, reading them one
+// at a time so that long histories are not loaded into memory. It stops at the first error of fn.
+func EachStats(signalID int, fn func(model.Stats) error) error {
+	return eachRow("stats", "SELECT * FROM stats WHERE signal_id = $1 ORDER BY stats_time, id", []interface{}{signalID},
+		func(rows *sqlx.Rows) error {
+			var stats model.Stats
+			if err := rows.StructScan(&stats); err != nil {
 				return err
 			}
-		}
+			return fn(stats)
+		})
+}
 
-		for i, holding := range holdings {
-			totalStockBalance += holding.Price * float64(holding.NumShares)
-			if !pastStats {
-				totalStockEquity += prices[i] * float64(holding.NumShares)
-			}
+// StatsFilter selects the stats of a signal. From and To bound the stats time
+// inclusively and do not filter when they are zero.
+type StatsFilter struct {
+	SignalID int
+	From     int64
+	To       int64
+}
+
+// ListStats reads a page of the stats selected by the given filter, latest first
+func ListStats(filter StatsFilter, page Page) ([]model.Stats, string, error) {
+	q := listQuery{table: "stats"}
+	q.where("signal_id = ?", filter.SignalID)
+	if filter.From != 0 {
+		q.where("stats_time >= ?", filter.From)
+	}
+	if filter.To != 0 {
+		q.where("stats_time <= ?", filter.To)
+	}
+
+	results := []model.Stats{}
+	next, err := q.selectPage(&results, "stats_time", true, page)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return results, next, nil
+}
+
+// GetStatsAfterID reads the stats of the given signal with an id greater than the given one, in id order
+func GetStatsAfterID(signalID, afterID int) ([]model.Stats, error) {
+	if db == nil {
+		return nil, fmt.Errorf("no connection is created to the database")
+	}
+
+	var results []model.Stats
+	err := db.Select(&results, "SELECT * FROM stats WHERE signal_id = $1 AND id > $2 ORDER BY id", signalID, afterID)
+	if err != nil {
+		return nil, fmt.Errorf("error reading stats: %q", err)
+	}
+
+	return results, nil
+}
+
+// GetLastStatsID returns the greatest stats id of the given signal, or 0 if it has no stats
+func GetLastStatsID(signalID int) (int, error) {
+	if db == nil {
+		return 0, fmt.Errorf("no connection is created to the database")
+	}
+
+	var id int
+	if err := db.Get(&id, "SELECT COALESCE(max(id), 0) FROM stats WHERE signal_id = $1", signalID); err != nil {
+		return 0, fmt.Errorf("error reading last stats id: %q", err)
+	}
+
+	return id, nil
+}
+
+// GetStatsSince reads the stats of all the given signals taken at or after the given
+// time in a single query and maps them by signal id, oldest first
+func GetStatsSince(signalIDs []int, since int64) (map[int][]model.Stats, error) {
+	if db == nil {
+		return nil, fmt.Errorf("no connection is created to the database")
+	}
+
+	results := make(map[int][]model.Stats)
+	if len(signalIDs) == 0 {
+		return results, nil
+	}
+
+	query, args, err := sqlx.In("SELECT * FROM stats WHERE signal_id IN (?) AND stats_time >= ? ORDER BY stats_time, id",
+		signalIDs, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build stats query : %s", err)
+	}
+
+	var stats []model.Stats
+	if err = db.Select(&stats, db.Rebind(query), args...); err != nil {
+		return nil, fmt.Errorf("error reading stats: %q", err)
+	}
+
+	for _, s := range stats {
+		results[s.SignalID] = append(results[s.SignalID], s)
+	}
+
+	return results, nil
+}
+
+func updateStats(stats *model.Stats, profit, previousBalance float64, holdings []model.Holding, prices map[string]float64) error {
+	var totalStockBalance, totalStockEquity float64
+	for _, holding := range holdings {
+		totalStockBalance += holding.Price * float64(holding.NumShares)
+		if prices == nil {
+			totalStockEquity += holding.Price * float64(holding.NumShares)
+			continue
 		}
 
-		if pastStats {
-			totalStockEquity = totalStockBalance
+		price, ok := prices[holding.Code]
+		if !ok {
+			return fmt.Errorf("no price is found for stock %s", holding.Code)
 		}
+		totalStockEquity += price * float64(holding.NumShares)
 	}
 
 	stats.Balance = totalStockBalance + stats.Funds
@@ -134,6 +225,46 @@ func updateStats(stats *model.Stats, profit, previousBalance float64, holdings [
 	return nil
 }
 
+// getBidPrices returns the current bid prices of the given holdings keyed by stock code.
+// It fails if any of the holdings has no price.
+func getBidPrices(holdings []model.Holding) (map[string]float64, error) {
+	prices, missing, err := getAvailableBidPrices(holdings)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = checkPrices(holdings, missing); err != nil {
+		return nil, err
+	}
+
+	return prices, nil
+}
+
+// getAvailableBidPrices returns the current bid prices of the given holdings keyed by stock code,
+// and the set of the codes without a price.
+func getAvailableBidPrices(holdings []model.Holding) (map[string]float64, map[string]bool, error) {
+	if len(holdings) == 0 {
+		return map[string]float64{}, nil, nil
+	}
+
+	var stocks []string
+	for _, holding := range holdings {
+		stocks = append(stocks, holding.Code)
+	}
+
+	prices, missingCodes, err := stockapi.GetBidPriceMap(stocks)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	missing := make(map[string]bool)
+	for _, code := range missingCodes {
+		missing[code] = true
+	}
+
+	return prices, missing, nil
+}
+
 func deleteStatsBySignalID(signalID int, tx *sqlx.Tx) error {
 	if tx == nil {
 		return fmt.Errorf("given transaction is nil")
@@ -147,25 +278,146 @@ func deleteStatsBySignalID(signalID int, tx *sqlx.Tx) error {
 	return nil
 }
 
+// SignalStatsError reports the failure of saving the stats of a single signal.
+type SignalStatsError struct {
+	SignalID int
+	Err      error
+}
+
+func (e *SignalStatsError) Error() string {
+	return fmt.Sprintf("failed to save stats for signal %d : %s", e.SignalID, e.Err)
+}
+
+// MarshalJSON encodes the error with its signal ID and message.
+func (e *SignalStatsError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"signal_id": e.SignalID,
+		"error":     e.Err.Error(),
+	})
+}
+
+// StatsSnapshot summarizes a stats snapshot run over several signals.
+type StatsSnapshot struct {
+	Saved  []int               `json:"saved"`
+	Failed []*SignalStatsError `json:"failed"`
+}
+
+// SaveStats computes and saves new stats for the given signal with the current prices of its holdings.
 func SaveStats(signalID int) error {
-	tx := db.MustBegin()
+	holdings, err := GetHoldingsBySignalID(signalID, "", true)
+	if err != nil {
+		return fmt.Errorf("failed to get holdings for signal %d: %s", signalID, err)
+	}
+
+	prices, err := getBidPrices(holdings)
+	if err != nil {
+		return fmt.Errorf("failed to get prices for signal %d: %s", signalID, err)
+	}
+
+	return saveStats(signalID, holdings, prices)
+}
+
+// SaveSignalsStats saves new stats for all the given signals. The prices of all
+// holdings are looked up in a single query and the signals are processed by at
+// most concurrency workers. A failing signal does not stop the others; its
+// error is reported in the returned snapshot. The signals holding a stock
+// without a price fail without stopping the others either.
+func SaveSignalsStats(signals []model.Signal, concurrency int) (*StatsSnapshot, error) {
+	if db == nil {
+		return nil, fmt.Errorf("no connection is created to the database")
+	}
+
+	if concurrency <= 0 {
+		concurrency = DEFAULT_STATS_CONCURRENCY
+	}
 
+	var ids []int
+	for _, signal := range signals {
+		ids = append(ids, signal.ID)
+	}
+
+	holdingsMap, err := getHoldingsBySignalIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var allHoldings []model.Holding
+	for _, holdings := range holdingsMap {
+		allHoldings = append(allHoldings, holdings...)
+	}
+
+	prices, missing, err := getAvailableBidPrices(allHoldings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get prices of the holdings : %s", err)
+	}
+
+	snapshot := &StatsSnapshot{Saved: []int{}, Failed: []*SignalStatsError{}}
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for _, id := range ids {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(signalID int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			err := checkPrices(holdingsMap[signalID], missing)
+			if err == nil {
+				err = saveStats(signalID, holdingsMap[signalID], prices)
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				snapshot.Failed = append(snapshot.Failed, &SignalStatsError{SignalID: signalID, Err: err})
+				return
+			}
+			snapshot.Saved = append(snapshot.Saved, signalID)
+		}(id)
+	}
+	wg.Wait()
+
+	sort.Ints(snapshot.Saved)
+	sort.Slice(snapshot.Failed, func(i, j int) bool {
+		return snapshot.Failed[i].SignalID < snapshot.Failed[j].SignalID
+	})
+
+	return snapshot, nil
+}
+
+// checkPrices fails if any of the given holdings is in the given set of the codes without a price
+func checkPrices(holdings []model.Holding, missing map[string]bool) error {
+	for _, holding := range holdings {
+		if missing[holding.Code] {
+			return fmt.Errorf("no price is returned for stock %s", holding.Code)
+		}
+	}
+	return nil
+}
+
+func saveStats(signalID int, holdings []model.Holding, prices map[string]float64) error {
 	stats, err := GetLatestStats(signalID)
 	if err != nil {
 		return fmt.Errorf("failed to get latest stats for signal %d: %s", signalID, err)
 	}
 
+	if stats == nil {
+		return fmt.Errorf("signal %d has no stats", signalID)
+	}
+
 	// Zero the stats time so that new stat would come with new time
 	stats.Time = 0
 
-	holdings, err := GetHoldingsBySignalID(signalID, "", true)
+	previousBalance := getStockBalance(holdings) + stats.Funds
+
+	tx, err := db.Beginx()
 	if err != nil {
-		return fmt.Errorf("failed to get holdings for signal %d: %s", signalID, err)
+		return fmt.Errorf("failed to begin transaction for signal %d: %s", signalID, err)
 	}
 
-	previousBalance := getStockBalance(holdings) + stats.Funds
-
-	if err = insertStats(tx, stats, 0, previousBalance, holdings, false); err != nil {
+	if err = insertStats(tx, stats, 0, previousBalance, holdings, prices); err != nil {
+		tx.Rollback()
 		return fmt.Errorf("failed to insert new stats for signal %d: %s", signalID, err)
 	}
 
@@ -2,8 +2,8 @@ package store
 
 import (
 	"fmt"
-	"os"
 
+	"github.com/heroku/stocksignals/config"
 	"github.com/jmoiron/sqlx"
 
 	_ "github.com/lib/pq"
@@ -13,26 +13,80 @@ const (
 	DEFAULT_SIGNAL_FIELD  = "price"
 	DEFAULT_ORDER_FIELD   = "order_time"
 	DEFAULT_HOLDING_FIELD = "num_shares"
+
+	// DEFAULT_STATS_CONCURRENCY is the default number of signals whose stats are saved in parallel.
+	DEFAULT_STATS_CONCURRENCY = 4
 )
 
 var (
 	db *sqlx.DB
 )
 
-func Connect() error {
+// Connect opens the database connection pool shared by the whole process.
+func Connect(cfg config.DatabaseConfig) error {
 	var err error
-	db, err = sqlx.Open("postgres", os.Getenv("DATABASE_URL"))
+	db, err = sqlx.Open("postgres", cfg.URL)
 	if err != nil {
-		return fmt.Errorf("Error opening database: %q %q", err, os.Getenv("DATABASE_URL"))
+		return fmt.Errorf("Error opening database: %q", err)
+	}
+
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	if err = db.Ping(); err != nil {
+		db.Close()
+		db = nil
+		return fmt.Errorf("Error connecting to database: %q", err)
+	}
+
+	return nil
+}
+
+// Migrate runs the given schema script, whose statements can be run again on an up to date database.
+func Migrate(script string) error {
+	if db == nil {
+		return fmt.Errorf("no connection is created to the database")
+	}
+
+	if _, err := db.Exec(script); err != nil {
+		return fmt.Errorf("failed to migrate the database : %s", err)
 	}
 
 	return nil
 }
 
+// Disconnect closes the database connection pool.
 func Disconnect() error {
 	if db == nil {
 		return nil
 	}
 
-	return db.Close()
+	err := db.Close()
+	db = nil
+	return err
+}
+
+// eachRow runs the given query and calls fn with the rows positioned on each result in turn
+func eachRow(table, query string, args []interface{}, fn func(*sqlx.Rows) error) error {
+	if db == nil {
+		return fmt.Errorf("no connection is created to the database")
+	}
+
+	rows, err := db.Queryx(query, args...)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %q", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err = fn(rows); err != nil {
+			return err
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error reading %s: %q", table, err)
+	}
+	return nil
 }
@@ -0,0 +1,193 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/heroku/stocksignals/model"
+	"github.com/jmoiron/sqlx"
+)
+
+// Subscribe starts a subscription of the given user to the given signal and
+// updates the number of subscribers of the signal in the same transaction.
+func Subscribe(userID, signalID int) (*model.Subscription, error) {
+	if db == nil {
+		return nil, fmt.Errorf("no connection is created to the database")
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin subscription : %s", err)
+	}
+	defer tx.Rollback()
+
+	signal, err := lockSignal(signalID, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	if signal.Archived() {
+		return nil, Conflict("signal %d is archived", signalID)
+	}
+
+	if signal.Follower {
+		return nil, Invalid("signal_id", "signal %d is the portfolio of a follower and cannot be subscribed to", signalID)
+	}
+
+	var count int
+	err = tx.Get(&count, "SELECT count(*) FROM subscriptions WHERE user_id = $1 AND signal_id = $2 AND status = $3",
+		userID, signalID, model.ACTIVE)
+	if err != nil {
+		return nil, fmt.Errorf("error reading subscriptions: %q", err)
+	}
+
+	if count > 0 {
+		return nil, Conflict("user %d is already subscribed to signal %d", userID, signalID)
+	}
+
+	subscription := model.Subscription{
+		UserID:    userID,
+		SignalID:  signalID,
+		StartTime: time.Now().Unix(),
+		Status:    model.ACTIVE,
+	}
+	err = tx.QueryRow("INSERT INTO subscriptions (user_id, signal_id, start_time, status) VALUES ($1, $2, $3, $4) returning id",
+		subscription.UserID, subscription.SignalID, subscription.StartTime, subscription.Status).Scan(&subscription.ID)
+	if err != nil {
+		return nil, wrapDB(err, "failed to insert subscription")
+	}
+
+	if err = updateNumSubscribers(signalID, tx); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to complete subscription : %s", err)
+	}
+
+	return &subscription, nil
+}
+
+// Unsubscribe cancels the active subscription of the given user to the given
+// signal, stops the followers of the user copying the signal and updates the
+// number of subscribers of the signal in the same transaction.
+func Unsubscribe(userID, signalID int) error {
+	if db == nil {
+		return fmt.Errorf("no connection is created to the database")
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin unsubscription : %s", err)
+	}
+	defer tx.Rollback()
+
+	if _, err = lockSignal(signalID, tx); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("UPDATE subscriptions SET status = $1, end_time = $2 WHERE user_id = $3 AND signal_id = $4 AND status = $5",
+		model.CANCELLED, time.Now().Unix(), userID, signalID, model.ACTIVE)
+	if err != nil {
+		return fmt.Errorf("failed to cancel subscription : %s", err)
+	}
+
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return NotFound("user %d is not subscribed to signal %d", userID, signalID)
+	}
+
+	_, err = tx.Exec("UPDATE followers SET status = $1 WHERE user_id = $2 AND leader_id = $3 AND status = $4",
+		model.STOPPED, userID, signalID, model.ACTIVE)
+	if err != nil {
+		return fmt.Errorf("failed to stop followers : %s", err)
+	}
+
+	if err = updateNumSubscribers(signalID, tx); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to complete unsubscription : %s", err)
+	}
+
+	return nil
+}
+
+// GetSubscriptionsByUserID reads the subscriptions of the given user, newest first.
+// If status is not empty, only the subscriptions with that status are returned.
+func GetSubscriptionsByUserID(userID int, status string) ([]model.Subscription, error) {
+	if db == nil {
+		return nil, fmt.Errorf("no connection is created to the database")
+	}
+
+	results := []model.Subscription{}
+	var err error
+	if status == "" {
+		err = db.Select(&results, "SELECT * FROM subscriptions WHERE user_id = $1 ORDER BY start_time DESC", userID)
+	} else {
+		err = db.Select(&results, "SELECT * FROM subscriptions WHERE user_id = $1 AND status = $2 ORDER BY start_time DESC", userID, status)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading subscriptions: %q", err)
+	}
+
+	return results, nil
+}
+
+// IsSubscribed reports whether the given user has an active subscription to the given signal
+func IsSubscribed(userID, signalID int) (bool, error) {
+	if db == nil {
+		return false, fmt.Errorf("no connection is created to the database")
+	}
+
+	var count int
+	err := db.Get(&count, "SELECT count(*) FROM subscriptions WHERE user_id = $1 AND signal_id = $2 AND status = $3",
+		userID, signalID, model.ACTIVE)
+	if err != nil {
+		return false, fmt.Errorf("error reading subscriptions: %q", err)
+	}
+
+	return count > 0, nil
+}
+
+// lockSignal reads the given signal and locks its row until the end of the transaction, so that
+// concurrent subscriptions count the subscribers one after the other and concurrent changes of
+// the signal are applied one after the other.
+func lockSignal(signalID int, tx *sqlx.Tx) (*model.Signal, error) {
+	var signal model.Signal
+	err := tx.Get(&signal, "SELECT * FROM signals WHERE id = $1 FOR UPDATE", signalID)
+	if err == sql.ErrNoRows {
+		return nil, NotFound("signal with id %d does not exist.", signalID)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading signal with id %d: %q", signalID, err)
+	}
+
+	return &signal, nil
+}
+
+func updateNumSubscribers(signalID int, tx *sqlx.Tx) error {
+	_, err := tx.Exec("UPDATE signals SET num_subscribers = "+
+		"(SELECT count(*) FROM subscriptions WHERE signal_id = $1 AND status = $2) WHERE id = $1",
+		signalID, model.ACTIVE)
+	if err != nil {
+		return fmt.Errorf("failed to update number of subscribers of signal %d : %s", signalID, err)
+	}
+
+	return nil
+}
+
+func deleteSubscriptionsBySignalID(signalID int, tx *sqlx.Tx) error {
+	if tx == nil {
+		return fmt.Errorf("given transaction is nil")
+	}
+
+	_, err := tx.Exec(fmt.Sprintf("DELETE FROM subscriptions WHERE signal_id = %d", signalID))
+	if err != nil {
+		return fmt.Errorf("failed to delete subscriptions from store : %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// RevokeToken marks the token with the given id as revoked until it expires.
+// Revoked tokens which are already expired are cleaned up.
+func RevokeToken(tokenID string, expiresAt int64) error {
+	if db == nil {
+		return fmt.Errorf("no connection is created to the database")
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin token revocation : %s", err)
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("DELETE FROM revoked_tokens WHERE expires_at < $1", time.Now().Unix()); err != nil {
+		return fmt.Errorf("failed to clean up revoked tokens : %s", err)
+	}
+
+	_, err = tx.Exec("INSERT INTO revoked_tokens (token_id, expires_at) VALUES ($1, $2) ON CONFLICT DO NOTHING", tokenID, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to revoke token : %s", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to complete token revocation : %s", err)
+	}
+
+	return nil
+}
+
+// IsTokenRevoked reports whether the token with the given id is revoked.
+func IsTokenRevoked(tokenID string) (bool, error) {
+	if db == nil {
+		return false, fmt.Errorf("no connection is created to the database")
+	}
+
+	var id string
+	err := db.Get(&id, "SELECT token_id FROM revoked_tokens WHERE token_id = $1", tokenID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("error reading revoked token: %q", err)
+	}
+
+	return true, nil
+}
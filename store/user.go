@@ -4,30 +4,57 @@ import (
 	"database/sql"
 	"fmt"
 
+	"github.com/heroku/stocksignals/auth"
 	"github.com/heroku/stocksignals/model"
 )
 
-// RegisterUser registers the given user to the database, if it doesn't exist with that email
+// ErrInvalidCredentials is returned when an email and password pair does not match a user.
+var ErrInvalidCredentials = fmt.Errorf("invalid email or password")
+
+// RegisterUser registers the given user to the database, if it doesn't exist with that email.
+// The password is stored as a bcrypt hash. Users are subscribers unless they register as providers.
 func RegisterUser(user model.User) error {
+	if user.Role == model.ADMIN {
+		return Invalid("role", "admin users cannot be registered")
+	}
+
+	return CreateUser(user)
+}
+
+// CreateUser is like RegisterUser but can also create admin users. It is meant for the operators.
+func CreateUser(user model.User) error {
 	if db == nil {
 		return fmt.Errorf("no connection is created to the database")
 	}
 
 	if user.Email == "" {
-		return fmt.Errorf("email cannot be empty")
+		return Invalid("email", "email cannot be empty")
+	}
+
+	switch user.Role {
+	case "":
+		user.Role = model.SUBSCRIBER
+	case model.ADMIN, model.PROVIDER, model.SUBSCRIBER:
+	default:
+		return Invalid("role", "unknown role %s", user.Role)
 	}
 
-	if len(user.Password) < 5 {
-		return fmt.Errorf("password length must be at least 5 characters")
+	if len(user.Password) < auth.MIN_PASSWORD_LENGTH {
+		return Invalid("password", "password length must be at least %d characters", auth.MIN_PASSWORD_LENGTH)
 	}
 
+	hash, err := auth.HashPassword(user.Password)
+	if err != nil {
+		return err
+	}
+	user.Password = hash
+
 	var result model.User
-	err := db.Get(&result, fmt.Sprintf("SELECT * FROM users WHERE email='%s'", user.Email))
-	fmt.Println("Email : ", user.Email)
+	err = db.Get(&result, "SELECT * FROM users WHERE email=$1", user.Email)
 	if err == sql.ErrNoRows {
-		_, errRegister := db.NamedExec("INSERT INTO users (email, password) VALUES (:email, :password)", &user)
+		_, errRegister := db.NamedExec("INSERT INTO users (email, password, role) VALUES (:email, :password, :role)", &user)
 		if errRegister != nil {
-			return fmt.Errorf("error registering user with email %s: %q", user.Email, err)
+			return wrapDB(errRegister, fmt.Sprintf("error registering user with email %s", user.Email))
 		}
 		return nil
 	}
@@ -36,7 +63,56 @@ func RegisterUser(user model.User) error {
 		return fmt.Errorf("error reading user with email %s: %q", user.Email, err)
 	}
 
-	return fmt.Errorf("user already exists with email %s", user.Email)
+	return Conflict("user already exists with email %s", user.Email)
+}
+
+// VerifyUser checks the given password against the one stored for the user
+// with the given email and returns the user if they match. Plaintext or
+// outdated password hashes are rehashed once the password is verified.
+func VerifyUser(email, password string) (*model.User, error) {
+	user, err := GetUser(email)
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	if !auth.VerifyPassword(user.Password, password) {
+		return nil, ErrInvalidCredentials
+	}
+
+	if auth.NeedsRehash(user.Password) {
+		if err = updatePassword(user.ID, password); err != nil {
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+// ResetPassword replaces the password of the user with the given email
+func ResetPassword(email, password string) error {
+	if len(password) < auth.MIN_PASSWORD_LENGTH {
+		return Invalid("password", "password length must be at least %d characters", auth.MIN_PASSWORD_LENGTH)
+	}
+
+	user, err := GetUser(email)
+	if err != nil {
+		return err
+	}
+
+	return updatePassword(user.ID, password)
+}
+
+func updatePassword(userID int, password string) error {
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	if _, err = db.Exec("UPDATE users SET password = $1 WHERE id = $2", hash, userID); err != nil {
+		return fmt.Errorf("failed to update password of user %d : %s", userID, err)
+	}
+
+	return nil
 }
 
 // GetUser gets the user with the given email
@@ -46,13 +122,13 @@ func GetUser(email string) (*model.User, error) {
 	}
 
 	if email == "" {
-		return nil, fmt.Errorf("empty email cannot be queried")
+		return nil, Invalid("email", "empty email cannot be queried")
 	}
 
 	var result model.User
-	err := db.Get(&result, fmt.Sprintf("SELECT * FROM users WHERE email='%s'", email))
+	err := db.Get(&result, "SELECT * FROM users WHERE email=$1", email)
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("user with email %s does not exist.", email)
+		return nil, NotFound("user with email %s does not exist.", email)
 	}
 
 	if err != nil {
@@ -62,6 +138,25 @@ func GetUser(email string) (*model.User, error) {
 	return &result, nil
 }
 
+// GetUserByID gets the user with the given id
+func GetUserByID(id int) (*model.User, error) {
+	if db == nil {
+		return nil, fmt.Errorf("no connection is created to the database")
+	}
+
+	var result model.User
+	err := db.Get(&result, "SELECT * FROM users WHERE id=$1", id)
+	if err == sql.ErrNoRows {
+		return nil, NotFound("user with id %d does not exist.", id)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading user with id %d: %q", id, err)
+	}
+
+	return &result, nil
+}
+
 // GetUsers gets all the users
 func GetUsers() ([]model.User, error) {
 	if db == nil {
@@ -76,3 +171,16 @@ func GetUsers() ([]model.User, error) {
 
 	return results, nil
 }
+
+// ListUsers reads a page of the users in id order
+func ListUsers(page Page) ([]model.User, string, error) {
+	q := listQuery{table: "users"}
+
+	results := []model.User{}
+	next, err := q.selectPage(&results, "id", false, page)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return results, next, nil
+}
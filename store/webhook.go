@@ -0,0 +1,181 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/heroku/stocksignals/model"
+	"github.com/jmoiron/sqlx"
+)
+
+// RegisterWebhook registers the given webhook
+func RegisterWebhook(webhook model.Webhook) (*model.Webhook, error) {
+	if db == nil {
+		return nil, fmt.Errorf("no connection is created to the database")
+	}
+
+	webhook.CreatedTime = time.Now().Unix()
+	err := db.QueryRow("INSERT INTO webhooks (user_id, signal_id, url, secret, created_time) VALUES ($1, $2, $3, $4, $5) returning id",
+		webhook.UserID, webhook.SignalID, webhook.URL, webhook.Secret, webhook.CreatedTime).Scan(&webhook.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert webhook : %s", err)
+	}
+
+	return &webhook, nil
+}
+
+// GetWebhooksByUserID reads the webhooks of the given user without their secrets
+func GetWebhooksByUserID(userID int) ([]model.Webhook, error) {
+	if db == nil {
+		return nil, fmt.Errorf("no connection is created to the database")
+	}
+
+	results := []model.Webhook{}
+	err := db.Select(&results, "SELECT id, user_id, signal_id, url, created_time FROM webhooks WHERE user_id = $1 ORDER BY id", userID)
+	if err != nil {
+		return nil, fmt.Errorf("error reading webhooks: %q", err)
+	}
+
+	return results, nil
+}
+
+// GetWebhooksBySignalID reads the webhooks of the given signal with their secrets. Only the webhooks
+// of the users still allowed to receive its events are read: the active subscribers, the owner and the admins.
+func GetWebhooksBySignalID(signalID int) ([]model.Webhook, error) {
+	if db == nil {
+		return nil, fmt.Errorf("no connection is created to the database")
+	}
+
+	var results []model.Webhook
+	err := db.Select(&results, "SELECT webhooks.* FROM webhooks "+
+		"JOIN signals ON signals.id = webhooks.signal_id "+
+		"JOIN users ON users.id = webhooks.user_id "+
+		"WHERE webhooks.signal_id = $1 AND (signals.owner_id = webhooks.user_id OR users.role = $2 OR EXISTS "+
+		"(SELECT 1 FROM subscriptions WHERE subscriptions.user_id = webhooks.user_id "+
+		"AND subscriptions.signal_id = webhooks.signal_id AND subscriptions.status = $3))",
+		signalID, model.ADMIN, model.ACTIVE)
+	if err != nil {
+		return nil, fmt.Errorf("error reading webhooks: %q", err)
+	}
+
+	return results, nil
+}
+
+// GetWebhookByID reads the webhook with the given id with its secret
+func GetWebhookByID(id int) (*model.Webhook, error) {
+	if db == nil {
+		return nil, fmt.Errorf("no connection is created to the database")
+	}
+
+	var result model.Webhook
+	err := db.Get(&result, "SELECT * FROM webhooks WHERE id = $1", id)
+	if err == sql.ErrNoRows {
+		return nil, NotFound("webhook with id %d does not exist.", id)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading webhook with id %d: %q", id, err)
+	}
+
+	return &result, nil
+}
+
+// DeleteWebhook deletes the given webhook of the given user with its dead letters
+func DeleteWebhook(id, userID int) error {
+	if db == nil {
+		return fmt.Errorf("no connection is created to the database")
+	}
+
+	result, err := db.Exec("DELETE FROM webhooks WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook : %s", err)
+	}
+
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return NotFound("webhook with id %d does not exist.", id)
+	}
+
+	return nil
+}
+
+// SaveDeadLetter stores the given payload which could not be delivered
+func SaveDeadLetter(deadLetter model.DeadLetter) error {
+	if db == nil {
+		return fmt.Errorf("no connection is created to the database")
+	}
+
+	_, err := db.NamedExec("INSERT INTO webhook_dead_letters "+
+		"(webhook_id, event_type, payload, attempts, last_error, dead_letter_time) "+
+		"VALUES (:webhook_id, :event_type, :payload, :attempts, :last_error, :dead_letter_time)", &deadLetter)
+	if err != nil {
+		return fmt.Errorf("failed to insert dead letter of webhook %d : %s", deadLetter.WebhookID, err)
+	}
+
+	return nil
+}
+
+// GetDeadLettersByUserID reads the dead letters of the webhooks of the given user, newest first
+func GetDeadLettersByUserID(userID int) ([]model.DeadLetter, error) {
+	if db == nil {
+		return nil, fmt.Errorf("no connection is created to the database")
+	}
+
+	results := []model.DeadLetter{}
+	err := db.Select(&results, "SELECT webhook_dead_letters.* FROM webhook_dead_letters "+
+		"JOIN webhooks ON webhooks.id = webhook_dead_letters.webhook_id "+
+		"WHERE webhooks.user_id = $1 ORDER BY webhook_dead_letters.id DESC", userID)
+	if err != nil {
+		return nil, fmt.Errorf("error reading dead letters: %q", err)
+	}
+
+	return results, nil
+}
+
+// GetDeadLetterByID reads the dead letter with the given id
+func GetDeadLetterByID(id int) (*model.DeadLetter, error) {
+	if db == nil {
+		return nil, fmt.Errorf("no connection is created to the database")
+	}
+
+	var result model.DeadLetter
+	err := db.Get(&result, "SELECT * FROM webhook_dead_letters WHERE id = $1", id)
+	if err == sql.ErrNoRows {
+		return nil, NotFound("dead letter with id %d does not exist.", id)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading dead letter with id %d: %q", id, err)
+	}
+
+	return &result, nil
+}
+
+// UpdateDeadLetter records the outcome of a replay of the given dead letter.
+// A dead letter is marked as replayed when its delivery succeeds.
+func UpdateDeadLetter(deadLetter model.DeadLetter) error {
+	if db == nil {
+		return fmt.Errorf("no connection is created to the database")
+	}
+
+	_, err := db.NamedExec("UPDATE webhook_dead_letters SET attempts = :attempts, last_error = :last_error, "+
+		"replayed_time = :replayed_time WHERE id = :id", &deadLetter)
+	if err != nil {
+		return fmt.Errorf("failed to update dead letter %d : %s", deadLetter.ID, err)
+	}
+
+	return nil
+}
+
+func deleteWebhooksBySignalID(signalID int, tx *sqlx.Tx) error {
+	if tx == nil {
+		return fmt.Errorf("given transaction is nil")
+	}
+
+	_, err := tx.Exec(fmt.Sprintf("DELETE FROM webhooks WHERE signal_id = %d", signalID))
+	if err != nil {
+		return fmt.Errorf("failed to delete webhooks from store : %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,267 @@
+// Package validation checks the orders and signals given by the clients
+// before they reach the quote lookups or the store. The generic field rules
+// are the binding tags of the models; the rules depending on the order type
+// are checked here. All the invalid fields are reported together.
+package validation
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/heroku/stocksignals/model"
+	"github.com/heroku/stocksignals/store"
+	"gopkg.in/go-playground/validator.v8"
+)
+
+const (
+	// MIN_ORDER_TIME is the earliest accepted order time (2000-01-01 UTC).
+	MIN_ORDER_TIME = 946684800
+
+	// MAX_CLOCK_SKEW is how far in the future an order time can be, to tolerate client clocks running ahead.
+	MAX_CLOCK_SKEW = 5 * time.Minute
+
+	// MAX_TAGS is the greatest number of tags of a signal.
+	MAX_TAGS = 10
+)
+
+var (
+	// symbolPattern matches the stock symbols, optionally with a share class or market suffix such as BRK.B
+	symbolPattern = regexp.MustCompile(`^[A-Za-z0-9]{1,10}([.\-][A-Za-z0-9]{1,4})?$`)
+
+	// tagPattern matches the normalized tags, optionally prefixed with their category such as sector:technology
+	tagPattern = regexp.MustCompile(`^([a-z]+:)?[a-z0-9][a-z0-9 &.\-]{0,39}$`)
+
+	validate = validator.New(&validator.Config{TagName: "binding", FieldNameTag: "json"})
+)
+
+// Errors maps the invalid fields to their problem
+type Errors map[string]string
+
+// Add records the problem of the given field, keeping the first one reported
+func (e Errors) Add(field, format string, args ...interface{}) {
+	if _, ok := e[field]; !ok {
+		e[field] = fmt.Sprintf(format, args...)
+	}
+}
+
+// Merge records the problems of the given errors with the given prefix added to their fields
+func (e Errors) Merge(prefix string, errs Errors) {
+	for field, message := range errs {
+		e.Add(prefix+field, "%s", message)
+	}
+}
+
+// Err returns the validation error reporting all the problems, or nil if there is none
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+
+	err := store.Invalid("", "%d invalid field(s)", len(e))
+	err.Fields = map[string]string(e)
+	return err
+}
+
+// Struct checks the binding tags of the given struct, or of each struct of the given slice
+func Struct(obj interface{}) error {
+	errs := make(Errors)
+
+	value := reflect.Indirect(reflect.ValueOf(obj))
+	switch value.Kind() {
+	case reflect.Struct:
+		errs.Merge("", structErrors(value.Interface()))
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			if item := reflect.Indirect(value.Index(i)); item.Kind() == reflect.Struct {
+				errs.Merge(fmt.Sprintf("[%d].", i), structErrors(item.Interface()))
+			}
+		}
+	}
+
+	return errs.Err()
+}
+
+func structErrors(obj interface{}) Errors {
+	errs := make(Errors)
+
+	fieldErrors, ok := validate.Struct(obj).(validator.ValidationErrors)
+	if !ok {
+		return errs
+	}
+
+	for _, fieldError := range fieldErrors {
+		switch fieldError.Tag {
+		case "required":
+			errs.Add(fieldError.Name, "is required")
+		case "min", "gte":
+			errs.Add(fieldError.Name, "must be at least %s", fieldError.Param)
+		case "max", "lte":
+			errs.Add(fieldError.Name, "must be at most %s", fieldError.Param)
+		case "gt":
+			errs.Add(fieldError.Name, "must be greater than %s", fieldError.Param)
+		default:
+			errs.Add(fieldError.Name, "failed on the %s rule", fieldError.Tag)
+		}
+	}
+	return errs
+}
+
+// Symbol checks the format of the given stock symbol
+func Symbol(code string) error {
+	if !symbolPattern.MatchString(code) {
+		return fmt.Errorf("invalid stock symbol %q", code)
+	}
+	return nil
+}
+
+// Order checks the given order with the rules of its type. The order time is
+// optional, but it cannot be before MIN_ORDER_TIME or more than MAX_CLOCK_SKEW
+// after the given time.
+func Order(order model.Order, now time.Time) Errors {
+	errs := structErrors(order)
+
+	if order.SignalID <= 0 {
+		errs.Add("signal_id", "is required")
+	}
+
+	if order.Time != 0 {
+		if order.Time < MIN_ORDER_TIME {
+			errs.Add("order_time", "must not be before %s", time.Unix(MIN_ORDER_TIME, 0).UTC().Format(time.RFC3339))
+		} else if order.Time > now.Add(MAX_CLOCK_SKEW).Unix() {
+			errs.Add("order_time", "must not be in the future")
+		}
+	}
+
+	switch order.Type {
+	case model.BUY, model.ADD, model.SELL, model.REDUCE:
+		if order.Code == "" {
+			errs.Add("code", "is required for %s orders", order.Type)
+		} else if err := Symbol(order.Code); err != nil {
+			errs.Add("code", "%s", err)
+		}
+
+		if order.NumShares <= 0 {
+			errs.Add("num_shares", "must be greater than 0 for %s orders", order.Type)
+		}
+
+		if order.Price < 0 {
+			errs.Add("price", "must not be negative")
+		}
+	case model.DEPOSIT, model.WITHDRAW:
+		if order.Profit <= 0 {
+			errs.Add("profit", "must be greater than 0 for %s orders", order.Type)
+		}
+
+		if order.Code != "" || order.NumShares != 0 || order.Price != 0 {
+			errs.Add("code", "must be empty with num_shares and price for %s orders", order.Type)
+		}
+	case "":
+	default:
+		errs.Add("type", "unknown order type %s", order.Type)
+	}
+
+	return errs
+}
+
+// Orders checks all the given orders, reporting their problems with the index of the order
+func Orders(orders []model.Order, now time.Time) error {
+	errs := make(Errors)
+	if len(orders) == 0 {
+		errs.Add("orders", "no order is given")
+	}
+
+	for i, order := range orders {
+		errs.Merge(fmt.Sprintf("[%d].", i), Order(order, now))
+	}
+
+	return errs.Err()
+}
+
+// Signal checks the given signal
+func Signal(signal model.Signal) Errors {
+	errs := structErrors(signal)
+	errs.Merge("", Tags(signal.Tags))
+	return errs
+}
+
+// Tags checks the given signal tags once normalized. The category of a tag must be
+// one of model.TAG_CATEGORIES, and the value of a risk tag one of model.RISK_LEVELS.
+func Tags(tags model.Tags) Errors {
+	errs := make(Errors)
+	if len(tags) > MAX_TAGS {
+		errs.Add("tags", "must be at most %d tags", MAX_TAGS)
+	}
+
+	for i, tag := range tags {
+		field := fmt.Sprintf("tags[%d]", i)
+		tag = model.NormalizeTag(tag)
+		if !tagPattern.MatchString(tag) {
+			errs.Add(field, "invalid tag %q", tag)
+			continue
+		}
+
+		parts := strings.SplitN(tag, ":", 2)
+		if len(parts) < 2 {
+			continue
+		}
+
+		if !contains(model.TAG_CATEGORIES, parts[0]) {
+			errs.Add(field, "tag category must be one of %v", model.TAG_CATEGORIES)
+		} else if parts[0] == model.TAG_RISK && !contains(model.RISK_LEVELS, parts[1]) {
+			errs.Add(field, "risk level must be one of %v", model.RISK_LEVELS)
+		}
+	}
+	return errs
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// SignalUpdate checks the given signal metadata update
+func SignalUpdate(update model.SignalUpdate) error {
+	errs := make(Errors)
+	if update.Name != nil && (*update.Name == "" || len(*update.Name) > 100) {
+		errs.Add("name", "must be between 1 and 100 characters")
+	}
+
+	if update.Description != nil && len(*update.Description) > 1000 {
+		errs.Add("description", "must be at most 1000 characters")
+	}
+
+	if update.Price != nil && *update.Price <= 0 {
+		errs.Add("price", "must be greater than 0")
+	}
+
+	if update.Tags != nil {
+		errs.Merge("", Tags(*update.Tags))
+	}
+
+	if update.Version < 0 {
+		errs.Add("version", "must not be negative")
+	}
+
+	return errs.Err()
+}
+
+// Signals checks all the given signals, reporting their problems with the index of the signal
+func Signals(signals []model.Signal) error {
+	errs := make(Errors)
+	if len(signals) == 0 {
+		errs.Add("signals", "no signal is given")
+	}
+
+	for i, signal := range signals {
+		errs.Merge(fmt.Sprintf("[%d].", i), Signal(signal))
+	}
+
+	return errs.Err()
+}
@@ -0,0 +1,31 @@
+package webhook
+
+import (
+	"context"
+	"time"
+)
+
+// Retry calls attempt until it succeeds, up to maxAttempts times, waiting backoff, then twice
+// as long, between the attempts. It returns the number of attempts and the last error, or the
+// error of the context if it is done while waiting.
+func Retry(ctx context.Context, maxAttempts int, backoff time.Duration, attempt func() error) (int, error) {
+	var err error
+	attempts := 0
+	for attempts < maxAttempts {
+		if attempts > 0 {
+			select {
+			case <-ctx.Done():
+				return attempts, ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		attempts++
+		if err = attempt(); err == nil {
+			return attempts, nil
+		}
+	}
+
+	return attempts, err
+}
@@ -0,0 +1,62 @@
+package webhook
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// CheckURL checks that the given webhook URL is an http or https URL whose host only resolves to
+// public addresses, so that the payloads cannot be posted to the private network of the server.
+func CheckURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("invalid url %s", rawURL)
+	}
+
+	ips, err := net.LookupIP(u.Hostname())
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s : %s", u.Hostname(), err)
+	}
+
+	for _, ip := range ips {
+		if !public(ip) {
+			return fmt.Errorf("%s resolves to the non public address %s", u.Hostname(), ip)
+		}
+	}
+
+	return nil
+}
+
+// NewClient creates an HTTP client whose requests time out after the given duration and which
+// refuses to connect to non public addresses, even when a checked host is resolved again to one
+// or a response redirects to one.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			if ip := net.ParseIP(host); ip == nil || !public(ip) {
+				return fmt.Errorf("connection to the non public address %s is refused", host)
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+func public(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() && !ip.IsUnspecified()
+}
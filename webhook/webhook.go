@@ -0,0 +1,247 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/heroku/stocksignals/events"
+	"github.com/heroku/stocksignals/model"
+	"github.com/heroku/stocksignals/store"
+)
+
+const (
+	// SIGNATURE_HEADER holds the hex HMAC-SHA256 of "<timestamp>.<body>" keyed
+	// with the webhook secret, prefixed by "sha256=".
+	SIGNATURE_HEADER = "X-Stocksignals-Signature"
+
+	// TIMESTAMP_HEADER holds the unix time the payload is signed at.
+	TIMESTAMP_HEADER = "X-Stocksignals-Timestamp"
+
+	// EVENT_HEADER holds the type of the event in the payload.
+	EVENT_HEADER = "X-Stocksignals-Event"
+
+	// DELIVERY_HEADER holds the id of the payload, which is the same for all its attempts.
+	DELIVERY_HEADER = "X-Stocksignals-Delivery"
+)
+
+// Payload is the JSON body posted to the webhooks.
+type Payload struct {
+	ID string `json:"id"`
+	events.Event
+}
+
+// NewSecret generates a random secret to sign the payloads of a webhook.
+func NewSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret : %s", err)
+	}
+
+	return hex.EncodeToString(secret), nil
+}
+
+// Sign returns the signature of the given body sent at the given time.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Deliverer posts the order and stats events of the signals to their webhooks.
+// Failed deliveries are retried with an exponential backoff, then stored as dead letters.
+type Deliverer struct {
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+	sem         chan struct{}
+	wg          sync.WaitGroup
+}
+
+// NewDeliverer creates a deliverer whose requests time out after the given
+// duration. A payload is attempted up to maxAttempts times, waiting backoff,
+// then twice as long, between the attempts. At most workers payloads are
+// delivered at the same time.
+func NewDeliverer(timeout time.Duration, maxAttempts int, backoff time.Duration, workers int) *Deliverer {
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+
+	if workers <= 0 {
+		workers = 1
+	}
+
+	return &Deliverer{
+		client:      NewClient(timeout),
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+		sem:         make(chan struct{}, workers),
+	}
+}
+
+// Run delivers the events received from the given subscription until the
+// context is done, then waits for the running deliveries.
+func (d *Deliverer) Run(ctx context.Context, subscription *events.Subscription) {
+	defer d.wg.Wait()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-subscription.C:
+			if !ok {
+				return
+			}
+
+			if event.Type == events.ORDER || event.Type == events.STATS || event.Type == events.COPY_SKIPPED {
+				d.dispatch(ctx, event)
+			}
+		}
+	}
+}
+
+func (d *Deliverer) dispatch(ctx context.Context, event events.Event) {
+	webhooks, err := store.GetWebhooksBySignalID(event.SignalID)
+	if err != nil {
+		log.Printf("failed to get webhooks of signal %d : %s", event.SignalID, err)
+		return
+	}
+
+	for _, webhook := range webhooks {
+		id := make([]byte, 16)
+		if _, err = rand.Read(id); err != nil {
+			log.Printf("failed to generate webhook delivery id : %s", err)
+			return
+		}
+
+		payload, err := json.Marshal(Payload{ID: hex.EncodeToString(id), Event: event})
+		if err != nil {
+			log.Printf("failed to encode %s event of signal %d : %s", event.Type, event.SignalID, err)
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case d.sem <- struct{}{}:
+		}
+
+		d.wg.Add(1)
+		go func(webhook model.Webhook) {
+			defer d.wg.Done()
+			defer func() { <-d.sem }()
+
+			d.deliverWithRetries(ctx, webhook, event.Type, payload)
+		}(webhook)
+	}
+}
+
+func (d *Deliverer) deliverWithRetries(ctx context.Context, webhook model.Webhook, eventType string, payload []byte) {
+	deadLetter := model.DeadLetter{WebhookID: webhook.ID, EventType: eventType, Payload: string(payload)}
+
+	var lastErr error
+	attempts, err := Retry(ctx, d.maxAttempts, d.backoff, func() error {
+		lastErr = d.Deliver(webhook, eventType, payload)
+		return lastErr
+	})
+	if err == nil {
+		return
+	}
+
+	deadLetter.Attempts = attempts
+	deadLetter.LastError = lastErr.Error()
+	if err == ctx.Err() {
+		deadLetter.LastError = "delivery is interrupted by shutdown : " + deadLetter.LastError
+	}
+
+	deadLetter.Time = time.Now().Unix()
+	d.saveDeadLetter(deadLetter)
+}
+
+func (d *Deliverer) saveDeadLetter(deadLetter model.DeadLetter) {
+	if err := store.SaveDeadLetter(deadLetter); err != nil {
+		log.Printf("failed to store dead letter : %s", err)
+	}
+}
+
+// Deliver makes a single attempt to post the given payload to the webhook and expects a 2xx response.
+func (d *Deliverer) Deliver(webhook model.Webhook, eventType string, payload []byte) error {
+	var body struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(payload, &body); err != nil {
+		return fmt.Errorf("invalid webhook payload : %s", err)
+	}
+
+	request, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request to webhook %d : %s", webhook.ID, err)
+	}
+
+	timestamp := time.Now().Unix()
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(EVENT_HEADER, eventType)
+	request.Header.Set(DELIVERY_HEADER, body.ID)
+	request.Header.Set(TIMESTAMP_HEADER, strconv.FormatInt(timestamp, 10))
+	request.Header.Set(SIGNATURE_HEADER, Sign(webhook.Secret, timestamp, payload))
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("failed to post to webhook %d : %s", webhook.ID, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("webhook %d responded with status %d", webhook.ID, response.StatusCode)
+	}
+
+	return nil
+}
+
+// Replay makes a new attempt to deliver the dead letter with the given id of
+// the given user. The dead letter is marked as replayed if it succeeds.
+func (d *Deliverer) Replay(deadLetterID, userID int) (*model.DeadLetter, error) {
+	deadLetter, err := store.GetDeadLetterByID(deadLetterID)
+	if err != nil {
+		return nil, err
+	}
+
+	webhook, err := store.GetWebhookByID(deadLetter.WebhookID)
+	if err != nil {
+		return nil, err
+	}
+
+	if webhook.UserID != userID {
+		return nil, fmt.Errorf("dead letter %d does not belong to user %d", deadLetterID, userID)
+	}
+
+	if deadLetter.ReplayedTime != nil {
+		return nil, fmt.Errorf("dead letter %d is already replayed", deadLetterID)
+	}
+
+	deadLetter.Attempts++
+	if errDeliver := d.Deliver(*webhook, deadLetter.EventType, []byte(deadLetter.Payload)); errDeliver != nil {
+		deadLetter.LastError = errDeliver.Error()
+	} else {
+		now := time.Now().Unix()
+		deadLetter.ReplayedTime = &now
+	}
+
+	if err = store.UpdateDeadLetter(*deadLetter); err != nil {
+		return nil, err
+	}
+
+	return deadLetter, nil
+}